@@ -0,0 +1,226 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/xshellinc/tools/lib/help"
+	"github.com/xshellinc/tools/lib/release"
+	"gopkg.in/yaml.v2"
+)
+
+// SchemaVersion is the version of the catalog format read by this package
+const SchemaVersion = 1
+
+// Archive types of images
+const (
+	ArchiveNone  = "img"
+	ArchiveZip   = "zip"
+	ArchiveGzip  = "gz"
+	ArchiveXz    = "xz"
+	ArchiveBzip2 = "bz2"
+	ArchiveZstd  = "zst"
+	ArchiveTar   = "tar"
+	ArchiveTarGz = "tar.gz"
+	ArchiveTarXz = "tar.xz"
+)
+
+var archives = []string{ArchiveTarGz, ArchiveTarXz, ArchiveTar, ArchiveZip, ArchiveGzip, ArchiveXz, ArchiveBzip2, ArchiveZstd, ArchiveNone}
+
+// Catalog maps device types to their OS images
+type Catalog struct {
+	Version int `json:"version" yaml:"version"`
+	// Devices are keyed by the constants.DEVICE_TYPE_* values
+	Devices map[string]*Device `json:"devices" yaml:"devices"`
+}
+
+// Device is a device type with its images
+type Device struct {
+	// Type is the key of the device in the catalog
+	Type string `json:"-" yaml:"-"`
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Arch is one of the constants.ARMv7, constants.ARM64... values
+	Arch   string   `json:"arch,omitempty" yaml:"arch,omitempty"`
+	Images []*Image `json:"images" yaml:"images"`
+}
+
+// Image is an OS image of a device
+type Image struct {
+	Title   string `json:"title" yaml:"title"`
+	Version string `json:"version" yaml:"version"`
+	OS      string `json:"os,omitempty" yaml:"os,omitempty"`
+	// URLs are mirrors of the same file tried in order
+	URLs []string `json:"urls" yaml:"urls"`
+	// Digest is the checksum of the file in the `algorithm:hex` form
+	Digest string `json:"digest,omitempty" yaml:"digest,omitempty"`
+	// Archive is one of the Archive* types, it's detected from the url when it's empty
+	Archive string `json:"archive,omitempty" yaml:"archive,omitempty"`
+	Size    int64  `json:"size,omitempty" yaml:"size,omitempty"`
+	Login   Login  `json:"login" yaml:"login"`
+	// Default marks the image offered first, the latest one is used when none is marked
+	Default bool `json:"default,omitempty" yaml:"default,omitempty"`
+}
+
+// Login is the default user of an image
+type Login struct {
+	User     string `json:"user" yaml:"user"`
+	Password string `json:"password" yaml:"password"`
+}
+
+// Parse parses a JSON or YAML catalog and validates it, unknown fields are rejected
+func Parse(data []byte) (*Catalog, error) {
+	c := &Catalog{}
+
+	data = bytes.TrimSpace(data)
+	var err error
+	if bytes.HasPrefix(data, []byte("{")) {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(c)
+	} else {
+		err = yaml.UnmarshalStrict(data, c)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid catalog: %s", err.Error())
+	}
+
+	for t, d := range c.Devices {
+		if d == nil {
+			d = &Device{}
+			c.Devices[t] = d
+		}
+		d.Type = t
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Load reads the catalog file
+func Load(file string) (*Catalog, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Fetch downloads the catalog from the url with the downloader, catalogs larger than 16MB
+// are rejected with help.ErrFetchTooLarge
+func Fetch(ctx context.Context, d *help.Downloader, rawurl string) (*Catalog, error) {
+	data, err := d.Fetch(ctx, rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("can't fetch catalog %s: %w", rawurl, err)
+	}
+	return Parse(data)
+}
+
+// DeviceTypes returns the sorted device types of the catalog
+func (c *Catalog) DeviceTypes() []string {
+	types := make([]string, 0, len(c.Devices))
+	for t := range c.Devices {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Device returns the device of the type
+func (c *Catalog) Device(deviceType string) (*Device, bool) {
+	d, ok := c.Devices[deviceType]
+	return d, ok
+}
+
+// Images returns images of the device type for the os, all of them when the os is empty.
+// Images are sorted from the newest version
+func (c *Catalog) Images(deviceType, os string) []*Image {
+	d, ok := c.Device(deviceType)
+	if !ok {
+		return nil
+	}
+	return d.Find(os)
+}
+
+// Find returns images for the os, all of them when the os is empty, sorted from the newest version
+func (d *Device) Find(os string) []*Image {
+	var images []*Image
+	for _, i := range d.Images {
+		if os == "" || strings.EqualFold(i.OS, os) {
+			images = append(images, i)
+		}
+	}
+	sort.SliceStable(images, func(a, b int) bool {
+		return release.CompareVersions(images[a].Version, images[b].Version) > 0
+	})
+	return images
+}
+
+// Latest returns the newest image for the os, any os when it's empty
+func (d *Device) Latest(os string) (*Image, bool) {
+	images := d.Find(os)
+	if len(images) == 0 {
+		return nil, false
+	}
+	return images[0], true
+}
+
+// Default returns the image marked as default or the latest one
+func (d *Device) Default() (*Image, bool) {
+	for _, i := range d.Images {
+		if i.Default {
+			return i, true
+		}
+	}
+	return d.Latest("")
+}
+
+// Image returns the image with the title and the version, the latest one when the version is empty
+func (d *Device) Image(title, version string) (*Image, bool) {
+	for _, i := range d.Find("") {
+		if strings.EqualFold(i.Title, title) && (version == "" || i.Version == version) {
+			return i, true
+		}
+	}
+	return nil, false
+}
+
+// ArchiveType returns the Archive or detects it from the extension of the first url
+func (i *Image) ArchiveType() string {
+	if i.Archive != "" {
+		return i.Archive
+	}
+	if len(i.URLs) == 0 {
+		return ArchiveNone
+	}
+	name := help.FileNameFromURL(i.URLs[0])
+	for _, a := range archives {
+		if strings.HasSuffix(name, "."+a) {
+			return a
+		}
+	}
+	if path.Ext(name) == ".tgz" {
+		return ArchiveTarGz
+	}
+	return ArchiveNone
+}
+
+// Download downloads the image from its mirrors into the destination folder verifying the digest
+func (i *Image) Download(ctx context.Context, d *help.Downloader, destination string) (*help.MirrorReport, error) {
+	dl := *d
+	if i.Digest != "" {
+		digest, err := help.ParseDigest(i.Digest)
+		if err != nil {
+			return nil, err
+		}
+		dl.Digest, dl.ChecksumURL = digest, ""
+	}
+	return dl.DownloadMirrors(ctx, i.URLs, destination, help.MirrorsInOrder)
+}
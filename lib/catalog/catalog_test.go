@@ -0,0 +1,158 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/xshellinc/tools/constants"
+	"github.com/xshellinc/tools/lib/help"
+)
+
+const testCatalog = `
+version: 1
+devices:
+  raspberry-pi:
+    name: Raspberry Pi
+    arch: armv7
+    images:
+      - title: Raspbian Lite
+        version: "2017-09-07"
+        os: raspbian
+        urls: [https://downloads.example.com/raspbian_lite-2017-09-07.zip]
+        login: {user: pi, password: raspberry}
+      - title: Raspbian Lite
+        version: "2017-11-29"
+        os: raspbian
+        urls:
+          - https://downloads.example.com/raspbian_lite-2017-11-29.zip
+          - https://mirror.example.org/raspbian_lite-2017-11-29.zip
+        digest: sha256:e942b70072f2e83c446b9de6f202eb8f9692c06e7d92c343361340cc016e0c9f
+        login: {user: pi, password: raspberry}
+      - title: Ubuntu Mate
+        version: "16.04.2"
+        os: ubuntu
+        urls: [https://downloads.example.com/ubuntu-mate-16.04.2-armhf.img.xz]
+        login: {user: ubuntu, password: ubuntu}
+  beaglebone:
+    arch: armv7
+    images:
+      - title: Debian
+        version: "9.3"
+        urls: [https://downloads.example.com/bone-debian-9.3.img.xz]
+        archive: xz
+        default: true
+        login: {user: ubuntu, password: temppwd}
+`
+
+func TestParse(t *testing.T) {
+	c, err := Parse([]byte(testCatalog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(c.DeviceTypes(), ","); got != "beaglebone,raspberry-pi" {
+		t.Errorf("DeviceTypes() = %s", got)
+	}
+
+	pi, ok := c.Device(constants.DEVICE_TYPE_RASPBERRY)
+	if !ok || pi.Type != constants.DEVICE_TYPE_RASPBERRY || pi.Arch != constants.ARMv7 {
+		t.Fatalf("Device() = %+v", pi)
+	}
+	if i, ok := pi.Latest("raspbian"); !ok || i.Version != "2017-11-29" || len(i.URLs) != 2 || i.ArchiveType() != ArchiveZip {
+		t.Errorf("Latest() = %+v", i)
+	}
+	if i, ok := pi.Image("ubuntu mate", ""); !ok || i.ArchiveType() != ArchiveXz || i.Login.User != "ubuntu" {
+		t.Errorf("Image() = %+v", i)
+	}
+	if images := c.Images(constants.DEVICE_TYPE_RASPBERRY, "raspbian"); len(images) != 2 || images[1].Version != "2017-09-07" {
+		t.Errorf("Images() = %d images", len(images))
+	}
+
+	bone, _ := c.Device(constants.DEVICE_TYPE_BEAGLEBONE)
+	if i, ok := bone.Default(); !ok || i.Login.Password != constants.DEFAULT_BEAGLEBONE_PASSWORD {
+		t.Errorf("Default() = %+v", i)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	c, err := Parse([]byte(`{"version": 1, "devices": {"tinker": {"images": [
+		{"title": "TinkerOS", "version": "2.0.4", "urls": ["https://example.com/tinker.img.gz"]}
+	]}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i, ok := c.Devices[constants.DEVICE_TYPE_TINKER].Default(); !ok || i.ArchiveType() != ArchiveGzip {
+		t.Errorf("Default() = %+v", i)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	_, err := Parse([]byte(`
+version: 2
+devices:
+  edison:
+    arch: x86_64
+    images:
+      - version: "1.0"
+        urls: [downloads/edison.zip]
+        digest: sha256:abc
+        archive: rar
+        default: true
+      - title: Yocto
+        version: "1.0"
+        urls: [https://example.com/yocto.zip]
+        default: true
+      - title: Yocto
+        version: "1.0"
+        urls: [https://example.com/yocto.zip]
+  raspbery-pi:
+    images:
+      - title: Raspbian
+        version: "1.0"
+        urls: [https://example.com/raspbian.zip]
+`))
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("Parse() error = %v, want a ValidationError", err)
+	}
+
+	want := []string{"unsupported catalog version", "unknown arch", "title is required", "invalid url",
+		"invalid digest", "unknown archive type", "listed twice", "marked as default",
+		`unknown device type "raspbery-pi"`}
+	for _, w := range want {
+		if !strings.Contains(verr.Error(), w) {
+			t.Errorf("Validate() error doesn't report %q:\n%s", w, verr.Error())
+		}
+	}
+
+	if _, err := Parse([]byte("version: 1\ndevices:\n  esp:\n    firmware: []\n")); err == nil {
+		t.Error("Parse() of an unknown field succeeded")
+	}
+}
+
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/huge.yaml" {
+			w.Write([]byte(testCatalog))
+			w.Write(make([]byte, 16*1024*1024))
+			return
+		}
+		w.Write([]byte(testCatalog))
+	}))
+	defer srv.Close()
+
+	d := help.NewDownloader()
+	c, err := Fetch(context.Background(), d, srv.URL+"/catalog.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Devices) != 2 {
+		t.Errorf("Fetch() devices = %d, want 2", len(c.Devices))
+	}
+	if _, err := Fetch(context.Background(), d, srv.URL+"/huge.yaml"); !errors.Is(err, help.ErrFetchTooLarge) {
+		t.Errorf("Fetch() error = %v, want help.ErrFetchTooLarge", err)
+	}
+}
@@ -0,0 +1,128 @@
+package catalog
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/xshellinc/tools/constants"
+	"github.com/xshellinc/tools/lib/help"
+)
+
+var arches = []string{constants.X86, constants.AMD64, constants.ARMv5, constants.ARMv6, constants.ARMv7, constants.ARM64}
+
+var deviceTypes = []string{constants.DEVICE_TYPE_RASPBERRY, constants.DEVICE_TYPE_EDISON, constants.DEVICE_TYPE_NANOPI,
+	constants.DEVICE_TYPE_BEAGLEBONE, constants.DEVICE_TYPE_COLIBRI, constants.DEVICE_TYPE_ESP, constants.DEVICE_TYPE_TINKER}
+
+// ValidationError lists all the problems found in a catalog
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid catalog:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+func (e *ValidationError) add(format string, args ...interface{}) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, args...))
+}
+
+// Validate checks the catalog against the schema, returns a *ValidationError
+func (c *Catalog) Validate() error {
+	e := &ValidationError{}
+
+	if c.Version != SchemaVersion {
+		e.add("unsupported catalog version %d, expected %d", c.Version, SchemaVersion)
+	}
+	if len(c.Devices) == 0 {
+		e.add("no devices")
+	}
+
+	for _, t := range c.DeviceTypes() {
+		d := c.Devices[t]
+		if strings.TrimSpace(t) == "" {
+			e.add("device with an empty type")
+		} else if !contains(deviceTypes, t) {
+			e.add("unknown device type %q", t)
+		}
+		if d == nil {
+			e.add("%s: no images", t)
+			continue
+		}
+		if d.Arch != "" && !contains(arches, d.Arch) {
+			e.add("%s: unknown arch %q", t, d.Arch)
+		}
+
+		defaults := 0
+		seen := make(map[string]bool)
+		for n, i := range d.Images {
+			where := fmt.Sprintf("%s: image %d", t, n+1)
+			if i == nil {
+				e.add("%s is empty", where)
+				continue
+			}
+			if i.Title != "" {
+				where = fmt.Sprintf("%s: %s %s", t, i.Title, i.Version)
+			}
+			i.validate(e, where)
+
+			key := strings.ToLower(i.Title) + "@" + i.Version
+			if seen[key] {
+				e.add("%s is listed twice", where)
+			}
+			seen[key] = true
+			if i.Default {
+				defaults++
+			}
+		}
+		if defaults > 1 {
+			e.add("%s: %d images are marked as default", t, defaults)
+		}
+	}
+
+	if len(e.Problems) > 0 {
+		return e
+	}
+	return nil
+}
+
+func (i *Image) validate(e *ValidationError, where string) {
+	if i.Title == "" {
+		e.add("%s: title is required", where)
+	}
+	if i.Version == "" {
+		e.add("%s: version is required", where)
+	}
+	if len(i.URLs) == 0 {
+		e.add("%s: at least one url is required", where)
+	}
+	for _, rawurl := range i.URLs {
+		u, err := url.Parse(rawurl)
+		if err != nil || u.Scheme == "" || (u.Host == "" && u.Scheme != "file") || u.Path == "" {
+			e.add("%s: invalid url %q", where, rawurl)
+		}
+	}
+	if i.Digest != "" {
+		if _, err := help.ParseDigest(i.Digest); err != nil {
+			e.add("%s: %s", where, err.Error())
+		}
+	}
+	if i.Archive != "" && !contains(archives, i.Archive) {
+		e.add("%s: unknown archive type %q", where, i.Archive)
+	}
+	if i.Size < 0 {
+		e.add("%s: negative size", where)
+	}
+	if i.Login.Password != "" && i.Login.User == "" {
+		e.add("%s: login password without a user", where)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,297 @@
+package help
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Limits of extraction used when ExtractOptions leave them zero
+const (
+	DefaultMaxExtractSize    int64   = 64 << 30
+	DefaultMaxExtractEntries         = 100000
+	DefaultMaxExtractRatio   float64 = 1000
+)
+
+// ratioThreshold is the amount of written bytes after which the compression ratio is checked,
+// so small archives of zeros aren't rejected
+const ratioThreshold = 16 << 20
+
+// Errors of unsafe archives, they are wrapped into *ArchiveEntryError
+var (
+	ErrPathTraversal    = errors.New("entry path is outside of the destination")
+	ErrSymlinkEscape    = errors.New("symlink points outside of the destination")
+	ErrTooManyEntries   = errors.New("too many entries")
+	ErrTooLarge         = errors.New("extracted size exceeds the limit")
+	ErrCompressionRatio = errors.New("compression ratio exceeds the limit")
+)
+
+// ArchiveEntryError is an unsafe entry of an archive
+type ArchiveEntryError struct {
+	Entry string
+	Err   error
+}
+
+func (e *ArchiveEntryError) Error() string {
+	return fmt.Sprintf("archive entry %q: %s", e.Entry, e.Err.Error())
+}
+
+func (e *ArchiveEntryError) Unwrap() error {
+	return e.Err
+}
+
+// ArchiveGuard applies the path safety rules and the limits of ExtractOptions to the entries
+// of an archive extracted into a folder. Names with ../ or absolute paths, symlinks pointing
+// outside of the folder and entries written through such symlinks are rejected, or skipped and
+// sanitized when Sanitize is set. Limits are enforced on the data read through the Reader.
+// Verify must be called once the entries are written
+type ArchiveGuard struct {
+	dst      string
+	realDst  string
+	sanitize bool
+
+	maxSize    int64
+	maxEntries int
+	maxRatio   float64
+	compressed int64
+
+	entries  int
+	written  int64
+	symlinks []archiveLink
+}
+
+// archiveLink is a written symlink entry
+type archiveLink struct {
+	name string
+	path string
+}
+
+// NewArchiveGuard returns the guard of the existing dst folder, compressedSize is the length
+// of the archive used for the ratio limit, zero disables it
+func NewArchiveGuard(dst string, opts *ExtractOptions, compressedSize int64) (*ArchiveGuard, error) {
+	if opts == nil {
+		opts = &ExtractOptions{}
+	}
+	dst, err := filepath.Abs(dst)
+	if err != nil {
+		return nil, err
+	}
+	realDst, err := filepath.EvalSymlinks(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &ArchiveGuard{
+		dst:        dst,
+		realDst:    realDst,
+		sanitize:   opts.Sanitize,
+		maxSize:    opts.MaxSize,
+		maxEntries: opts.MaxEntries,
+		maxRatio:   opts.MaxRatio,
+		compressed: compressedSize,
+	}
+	if g.maxSize == 0 {
+		g.maxSize = DefaultMaxExtractSize
+	}
+	if g.maxEntries == 0 {
+		g.maxEntries = DefaultMaxExtractEntries
+	}
+	if g.maxRatio == 0 {
+		g.maxRatio = DefaultMaxExtractRatio
+	}
+	return g, nil
+}
+
+// Entry counts an entry against the limit
+func (g *ArchiveGuard) Entry(name string) error {
+	g.entries++
+	if g.maxEntries > 0 && g.entries > g.maxEntries {
+		return &ArchiveEntryError{Entry: name, Err: ErrTooManyEntries}
+	}
+	return nil
+}
+
+// Path returns the destination of the entry, or an empty path if the entry is skipped
+func (g *ArchiveGuard) Path(name string) (string, error) {
+	clean, err := g.cleanName(name)
+	if err != nil || clean == "" {
+		return "", err
+	}
+
+	p := filepath.Join(g.dst, filepath.FromSlash(clean))
+	if err := g.checkPath(name, p); err != nil {
+		return "", err
+	}
+	return p, nil
+}
+
+// cleanName returns the slash separated relative name of the entry
+func (g *ArchiveGuard) cleanName(name string) (string, error) {
+	// archives made on windows use backslashes
+	n := strings.Replace(name, `\`, "/", -1)
+	if len(n) > 1 && n[1] == ':' {
+		n = n[2:]
+	}
+
+	unsafe := path.IsAbs(n)
+	for _, part := range strings.Split(n, "/") {
+		if part == ".." {
+			unsafe = true
+		}
+	}
+	if unsafe && !g.sanitize {
+		return "", &ArchiveEntryError{Entry: name, Err: ErrPathTraversal}
+	}
+
+	// ../ at the root is dropped like tar does
+	clean := strings.TrimPrefix(path.Clean("/"+n), "/")
+	if unsafe {
+		log.Warn("Archive entry ", name, " is extracted as ", clean)
+	}
+	return clean, nil
+}
+
+// maxSymlinks is the number of links followed while resolving a path, like the limit of the system
+const maxSymlinks = 40
+
+// resolveLinks returns the absolute path with the symlinks of its existing parts resolved in order,
+// as the system does when the path is used, so a/../b isn't b when a is a link. Parts which
+// don't exist are joined as they are
+func resolveLinks(p string) (string, error) {
+	sep := string(os.PathSeparator)
+	vol := filepath.VolumeName(p)
+	cur := vol + sep
+	parts := strings.Split(p[len(vol):], sep)
+	for links := 0; len(parts) > 0; {
+		part := parts[0]
+		parts = parts[1:]
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			cur = filepath.Dir(cur)
+			continue
+		}
+
+		next := filepath.Join(cur, part)
+		info, err := os.Lstat(next)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			cur = next
+			continue
+		}
+		if links++; links > maxSymlinks {
+			return "", fmt.Errorf("%s: too many levels of symbolic links", p)
+		}
+		link, err := os.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(link) {
+			vol = filepath.VolumeName(link)
+			cur = vol + sep
+			link = link[len(vol):]
+		}
+		parts = append(strings.Split(link, sep), parts...)
+	}
+	return cur, nil
+}
+
+// checkPath rejects entries written through symlinks to the outside of the destination
+func (g *ArchiveGuard) checkPath(name, p string) error {
+	real, err := resolveLinks(p)
+	if err != nil {
+		return &ArchiveEntryError{Entry: name, Err: err}
+	}
+	if !within(g.realDst, real) {
+		return &ArchiveEntryError{Entry: name, Err: ErrSymlinkEscape}
+	}
+	return nil
+}
+
+// Symlink returns the destination of a symlink entry, or an empty path if it's skipped
+func (g *ArchiveGuard) Symlink(name, linkname string) (string, error) {
+	p, err := g.Path(name)
+	if err != nil || p == "" {
+		return "", err
+	}
+
+	// the target is resolved through the links of the earlier entries, as the system will do,
+	// so it isn't cleaned before
+	target := filepath.FromSlash(strings.Replace(linkname, `\`, "/", -1))
+	if !filepath.IsAbs(target) {
+		target = filepath.Dir(p) + string(os.PathSeparator) + target
+	}
+	real, err := resolveLinks(target)
+	if err != nil || !within(g.realDst, real) {
+		if g.sanitize {
+			log.Warn("Skipping archive symlink ", name, " to ", linkname)
+			return "", nil
+		}
+		return "", &ArchiveEntryError{Entry: name, Err: ErrSymlinkEscape}
+	}
+	g.symlinks = append(g.symlinks, archiveLink{name: name, path: p})
+	return p, nil
+}
+
+// Verify checks the written symlinks again once all the entries are extracted, as later entries
+// may change where they point. Symlinks pointing outside of the destination are removed
+func (g *ArchiveGuard) Verify() error {
+	var first error
+	for _, link := range g.symlinks {
+		if err := g.checkPath(link.name, link.path); err == nil {
+			continue
+		}
+		if info, err := os.Lstat(link.path); err != nil || info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		os.Remove(link.path)
+		if g.sanitize {
+			log.Warn("Removed archive symlink ", link.name, " pointing outside of the destination")
+			continue
+		}
+		if first == nil {
+			first = &ArchiveEntryError{Entry: link.name, Err: ErrSymlinkEscape}
+		}
+	}
+	return first
+}
+
+// Link returns the destination and the target of a hardlink entry, or empty paths if it's skipped
+func (g *ArchiveGuard) Link(name, linkname string) (string, string, error) {
+	p, err := g.Path(name)
+	if err != nil || p == "" {
+		return "", "", err
+	}
+	target, err := g.Path(linkname)
+	if err != nil || target == "" {
+		return "", "", err
+	}
+	return p, target, nil
+}
+
+// Reader counts the data of the entry against the size and ratio limits
+func (g *ArchiveGuard) Reader(name string, r io.Reader) io.Reader {
+	return readerFunc(func(p []byte) (int, error) {
+		n, err := r.Read(p)
+		g.written += int64(n)
+		if g.maxSize > 0 && g.written > g.maxSize {
+			return n, &ArchiveEntryError{Entry: name, Err: ErrTooLarge}
+		}
+		if g.maxRatio > 0 && g.compressed > 0 && g.written > ratioThreshold &&
+			float64(g.written)/float64(g.compressed) > g.maxRatio {
+			return n, &ArchiveEntryError{Entry: name, Err: ErrCompressionRatio}
+		}
+		return n, err
+	})
+}
+
+// within returns true if the path is the dir or inside of it
+func within(dir, p string) bool {
+	return p == dir || strings.HasPrefix(p, strings.TrimSuffix(dir, string(os.PathSeparator))+string(os.PathSeparator))
+}
@@ -0,0 +1,144 @@
+package help
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtractUnsafe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "guard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	outside := filepath.Join(dir, "outside")
+	CreateDir(outside)
+
+	tests := []struct {
+		name    string
+		entries []testEntry
+		zip     bool
+		opts    *ExtractOptions
+		want    error
+	}{
+		{"traversal", []testEntry{{name: "../outside/evil", body: "x"}}, false, nil, ErrPathTraversal},
+		{"absolute", []testEntry{{name: filepath.ToSlash(outside) + "/evil", body: "x"}}, false, nil, ErrPathTraversal},
+		{"zip traversal", []testEntry{{name: "boot/../../outside/evil", body: "x"}}, true, nil, ErrPathTraversal},
+		{"backslash", []testEntry{{name: `..\outside\evil`, body: "x"}}, true, nil, ErrPathTraversal},
+		{"symlink escape", []testEntry{
+			{name: "link", typeflag: tar.TypeSymlink, linkname: outside},
+		}, false, nil, ErrSymlinkEscape},
+		{"relative symlink escape", []testEntry{
+			{name: "boot/link", typeflag: tar.TypeSymlink, linkname: "../../outside"},
+		}, false, nil, ErrSymlinkEscape},
+		// a link to the root makes ../ of a nested link escape
+		{"symlink chain", []testEntry{
+			{name: "a", typeflag: tar.TypeSymlink, linkname: "."},
+			{name: "a/l", typeflag: tar.TypeSymlink, linkname: "../outside"},
+		}, false, nil, ErrSymlinkEscape},
+		// the target is resolved through s rather than cleaned to a/victim
+		{"symlink through link", []testEntry{
+			{name: "a/b/s", typeflag: tar.TypeSymlink, linkname: "../.."},
+			{name: "a/b/x", typeflag: tar.TypeSymlink, linkname: "s/../../victim"},
+			{name: "a/b/x/", typeflag: tar.TypeDir},
+		}, false, nil, ErrSymlinkEscape},
+		// replacing c makes the checked x point outside
+		{"replaced symlink", []testEntry{
+			{name: "a/b/s", typeflag: tar.TypeSymlink, linkname: "../.."},
+			{name: "a/c", typeflag: tar.TypeSymlink, linkname: "."},
+			{name: "a/x", typeflag: tar.TypeSymlink, linkname: "c/../outside"},
+			{name: "a/c", typeflag: tar.TypeSymlink, linkname: "b/s"},
+		}, false, nil, ErrSymlinkEscape},
+		{"hardlink escape", []testEntry{
+			{name: "link", typeflag: tar.TypeLink, linkname: "../outside/secret"},
+		}, false, nil, ErrPathTraversal},
+		{"too many entries", []testEntry{{name: "a", body: "1"}, {name: "b", body: "2"}, {name: "c", body: "3"}},
+			false, &ExtractOptions{MaxEntries: 2}, ErrTooManyEntries},
+		{"too large", []testEntry{{name: "a", body: strings.Repeat("1", 100)}, {name: "b", body: strings.Repeat("2", 100)}},
+			true, &ExtractOptions{MaxSize: 150}, ErrTooLarge},
+		{"bomb", []testEntry{{name: "zeros.img", body: strings.Repeat("\x00", 32<<20)}},
+			true, &ExtractOptions{MaxRatio: 100}, ErrCompressionRatio},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		name := strings.Replace(tt.name, " ", "-", -1) + ".tar"
+		if tt.zip {
+			writeTestZip(&buf, tt.entries)
+			name += ".zip"
+		} else {
+			writeTestTar(&buf, tt.entries)
+		}
+		src := filepath.Join(dir, name)
+		ioutil.WriteFile(src, buf.Bytes(), 0644)
+
+		_, err := Extract(context.Background(), src, filepath.Join(dir, name+".d"), tt.opts)
+		var entryErr *ArchiveEntryError
+		if !errors.Is(err, tt.want) || !errors.As(err, &entryErr) {
+			t.Errorf("%q. Extract() error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	if files, _ := ioutil.ReadDir(outside); len(files) != 0 {
+		t.Errorf("Extract() wrote %d files outside of the destination", len(files))
+	}
+}
+
+func TestExtractSanitize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "guard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	writeTestTar(&buf, []testEntry{
+		{name: "../../etc/hosts", body: "127.0.0.1 edison"},
+		{name: "/boot/config.txt", body: "dtparam=audio=on"},
+		{name: "passwd", typeflag: tar.TypeSymlink, linkname: "/etc/passwd"},
+		{name: "hosts", typeflag: tar.TypeSymlink, linkname: "etc/hosts"},
+	})
+	src := filepath.Join(dir, "rootfs.tar")
+	ioutil.WriteFile(src, buf.Bytes(), 0644)
+	dst := filepath.Join(dir, "rootfs")
+
+	result, err := Extract(context.Background(), src, dst, &ExtractOptions{Sanitize: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := relPaths(dst, result.Files); !equalStrings(got, []string{"boot/config.txt", "etc/hosts"}) {
+		t.Errorf("Extract() files = %q", got)
+	}
+	if _, err := os.Lstat(filepath.Join(dst, "passwd")); !os.IsNotExist(err) {
+		t.Error("Extract() created the escaping symlink")
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dst, "hosts")); string(data) != "127.0.0.1 edison" {
+		t.Errorf("Extract() symlink reads %q", data)
+	}
+}
+
+func TestUnzipTraversal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "guard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	writeTestZip(&buf, []testEntry{{name: "../evil.sh", body: "rm -rf /"}})
+	src := filepath.Join(dir, "image.zip")
+	ioutil.WriteFile(src, buf.Bytes(), 0644)
+
+	if err := Unzip(src, filepath.Join(dir, "dst")); !errors.Is(err, ErrPathTraversal) {
+		t.Errorf("Unzip() error = %v, want ErrPathTraversal", err)
+	}
+	if Exists(filepath.Join(dir, "evil.sh")) {
+		t.Error("Unzip() wrote outside of the destination")
+	}
+}
@@ -0,0 +1,241 @@
+package help
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Types of archive entries
+const (
+	EntryFile    = "file"
+	EntryDir     = "dir"
+	EntrySymlink = "symlink"
+	EntryLink    = "link"
+	EntryOther   = "other"
+)
+
+// ErrNoMatch is returned when no archive entry matches the patterns
+var ErrNoMatch = errors.New("no archive entry matches")
+
+// errStopWalk ends walkArchive without an error
+var errStopWalk = errors.New("stop walking the archive")
+
+// ArchiveEntry is a file, folder or link stored in an archive
+type ArchiveEntry struct {
+	Name string
+	// Type is one of EntryFile, EntryDir, EntrySymlink, EntryLink or EntryOther
+	Type string
+	// Size is the uncompressed size, -1 if it's unknown
+	Size    int64
+	Mode    os.FileMode
+	ModTime time.Time
+	// Linkname is the target of symlinks and hardlinks
+	Linkname string
+	// Uid and Gid are the owner of tar entries
+	Uid int
+	Gid int
+}
+
+// List returns the entries of a tar or zip archive, or the single file of a compressed one,
+// the formats are detected like Extract does
+func List(src string) ([]ArchiveEntry, error) {
+	var entries []ArchiveEntry
+	_, _, err := walkArchive(context.Background(), src, func(e *ArchiveEntry, _ func() (io.ReadCloser, error)) error {
+		entries = append(entries, *e)
+		return nil
+	})
+	return entries, err
+}
+
+// ExtractMatching extracts the entries matching any of the patterns into the dst folder,
+// ErrNoMatch is returned if no file was extracted
+func ExtractMatching(ctx context.Context, src string, patterns []string, dst string) (*ExtractResult, error) {
+	result, err := Extract(ctx, src, dst, &ExtractOptions{Patterns: patterns})
+	if err == nil && len(result.Files) == 0 {
+		err = fmt.Errorf("%s: %w %q", src, ErrNoMatch, patterns)
+	}
+	return result, err
+}
+
+// ExtractMatchingTo writes the first regular file matching any of the patterns into w,
+// e.g. a config file of a tarball, and returns its entry
+func ExtractMatchingTo(ctx context.Context, src string, patterns []string, w io.Writer) (*ArchiveEntry, error) {
+	var found *ArchiveEntry
+	_, _, err := walkArchive(ctx, src, func(e *ArchiveEntry, open func() (io.ReadCloser, error)) error {
+		if e.Type != EntryFile || !MatchArchiveName(e.Name, patterns...) {
+			return nil
+		}
+		r, err := open()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		if _, err := io.Copy(w, r); err != nil {
+			return err
+		}
+		found = e
+		return errStopWalk
+	})
+	if err == nil && found == nil {
+		err = fmt.Errorf("%s: %w %q", src, ErrNoMatch, patterns)
+	}
+	return found, err
+}
+
+// MatchArchiveName returns true if the entry name matches any of the glob patterns. Patterns
+// without a slash match the base name in any folder, e.g. *.img, others match the whole name
+func MatchArchiveName(name string, patterns ...string) bool {
+	name = strings.TrimPrefix(path.Clean("/"+strings.Replace(name, `\`, "/", -1)), "/")
+	for _, p := range patterns {
+		p = strings.Trim(p, "/")
+		target := name
+		if !strings.Contains(p, "/") {
+			target = path.Base(name)
+		}
+		if ok, _ := path.Match(p, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// walkArchive calls fn with the entries of the archive, open returns the content of the entry.
+// fn returning errStopWalk ends the walk without an error. The detected format is returned
+func walkArchive(ctx context.Context, src string, fn func(e *ArchiveEntry, open func() (io.ReadCloser, error)) error) (string, Compression, error) {
+	f, compression, err := openArchive(src)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	format := ArchiveZip
+	if compression == CompressionZip {
+		err = walkZip(ctx, src, fn)
+	} else {
+		format, err = walkStream(ctx, f, src, compression, fn)
+	}
+	if err == errStopWalk {
+		err = nil
+	}
+	return format, compression, err
+}
+
+func walkZip(ctx context.Context, src string, fn func(e *ArchiveEntry, open func() (io.ReadCloser, error)) error) error {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		e := &ArchiveEntry{
+			Name:    f.Name,
+			Type:    EntryFile,
+			Size:    int64(f.UncompressedSize64),
+			Mode:    f.Mode(),
+			ModTime: f.Modified,
+		}
+		switch {
+		case f.FileInfo().IsDir():
+			e.Type = EntryDir
+		case f.Mode()&os.ModeSymlink != 0:
+			e.Type = EntrySymlink
+			if rc, err := f.Open(); err == nil {
+				linkname, _ := ioutil.ReadAll(io.LimitReader(rc, 4096))
+				rc.Close()
+				e.Linkname = string(linkname)
+			}
+		}
+		open := func() (io.ReadCloser, error) {
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			return struct {
+				io.Reader
+				io.Closer
+			}{contextReader(ctx, rc), rc}, nil
+		}
+		if err := fn(e, open); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkStream(ctx context.Context, f *os.File, src string, compression Compression, fn func(e *ArchiveEntry, open func() (io.ReadCloser, error)) error) (string, error) {
+	format, br, closer, err := openStream(ctx, f, src, compression)
+	if err != nil {
+		return "", err
+	}
+	defer closer.Close()
+
+	if format == ArchiveTar {
+		return format, walkTar(br, fn)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return format, err
+	}
+	e := &ArchiveEntry{Name: singleFileName(src), Type: EntryFile, Size: -1, Mode: 0644, ModTime: info.ModTime()}
+	if compression == CompressionXz {
+		if size, err := xzSize(f); err == nil {
+			e.Size = size
+		}
+	}
+	return format, fn(e, func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(br), nil
+	})
+}
+
+func walkTar(r io.Reader, fn func(e *ArchiveEntry, open func() (io.ReadCloser, error)) error) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		e := &ArchiveEntry{
+			Name:     hdr.Name,
+			Size:     hdr.Size,
+			Mode:     hdr.FileInfo().Mode(),
+			ModTime:  hdr.ModTime,
+			Linkname: hdr.Linkname,
+			Uid:      hdr.Uid,
+			Gid:      hdr.Gid,
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+			e.Type = EntryFile
+		case tar.TypeDir:
+			e.Type = EntryDir
+		case tar.TypeSymlink:
+			e.Type = EntrySymlink
+		case tar.TypeLink:
+			e.Type = EntryLink
+		default:
+			e.Type = EntryOther
+		}
+		if err := fn(e, func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(tr), nil
+		}); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package help
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchArchiveName(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		want     bool
+	}{
+		{"raspbian.img", []string{"*.img"}, true},
+		{"./images/raspbian.img", []string{"*.img"}, true},
+		{"images/raspbian.img", []string{"images/*.img"}, true},
+		{"other/raspbian.img", []string{"images/*.img"}, false},
+		{"boot/config.txt", []string{"*.img", "config.txt"}, true},
+		{`boot\config.txt`, []string{"boot/config.txt"}, true},
+		{"readme.txt", []string{"*.img"}, false},
+		{"readme.txt", nil, false},
+	}
+	for _, tt := range tests {
+		if got := MatchArchiveName(tt.name, tt.patterns...); got != tt.want {
+			t.Errorf("%q. MatchArchiveName(%q) = %v, want %v", tt.name, tt.patterns, got, tt.want)
+		}
+	}
+}
+
+func TestListAndExtractMatching(t *testing.T) {
+	dir, err := ioutil.TempDir("", "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	entries := []testEntry{
+		{name: "boot/", typeflag: tar.TypeDir},
+		{name: "boot/config.txt", body: "dtparam=audio=on"},
+		{name: "raspbian.img", body: "disk image"},
+		{name: "latest.img", typeflag: tar.TypeSymlink, linkname: "raspbian.img"},
+	}
+	var tarBuf, zipBuf bytes.Buffer
+	writeTestTar(&tarBuf, entries)
+	writeTestZip(&zipBuf, entries[1:3])
+	tarFile := filepath.Join(dir, "image.tar.gz")
+	ioutil.WriteFile(tarFile, compressTest(CompressionGzip, tarBuf.Bytes()), 0644)
+	zipFile := filepath.Join(dir, "image.zip")
+	ioutil.WriteFile(zipFile, zipBuf.Bytes(), 0644)
+	xzFile := filepath.Join(dir, "tinker.img.xz")
+	ioutil.WriteFile(xzFile, compressTest(CompressionXz, []byte("disk image")), 0644)
+
+	tests := []struct {
+		src   string
+		names []string
+		types []string
+		sizes []int64
+	}{
+		{tarFile, []string{"boot/", "boot/config.txt", "raspbian.img", "latest.img"},
+			[]string{EntryDir, EntryFile, EntryFile, EntrySymlink}, []int64{0, 16, 10, 0}},
+		{zipFile, []string{"boot/config.txt", "raspbian.img"}, []string{EntryFile, EntryFile}, []int64{16, 10}},
+		{xzFile, []string{"tinker.img"}, []string{EntryFile}, []int64{10}},
+	}
+	for _, tt := range tests {
+		list, err := List(tt.src)
+		if err != nil {
+			t.Errorf("%q. List() error = %v", filepath.Base(tt.src), err)
+			continue
+		}
+		var names, types []string
+		var sizes []int64
+		for _, e := range list {
+			names = append(names, e.Name)
+			types = append(types, e.Type)
+			sizes = append(sizes, e.Size)
+		}
+		if !equalStrings(names, tt.names) || !equalStrings(types, tt.types) || len(sizes) != len(tt.sizes) {
+			t.Errorf("%q. List() = %q %q, want %q %q", filepath.Base(tt.src), names, types, tt.names, tt.types)
+			continue
+		}
+		for i := range sizes {
+			if sizes[i] != tt.sizes[i] {
+				t.Errorf("%q. List() size of %s = %d, want %d", filepath.Base(tt.src), names[i], sizes[i], tt.sizes[i])
+			}
+		}
+	}
+
+	for _, src := range []string{tarFile, zipFile} {
+		dst := filepath.Join(dir, filepath.Base(src)+".d")
+		result, err := ExtractMatching(context.Background(), src, []string{"*.img"}, dst)
+		if err != nil {
+			t.Errorf("%q. ExtractMatching() error = %v", filepath.Base(src), err)
+			continue
+		}
+		if got := relPaths(dst, result.Files); !equalStrings(got, []string{"raspbian.img"}) {
+			t.Errorf("%q. ExtractMatching() files = %q", filepath.Base(src), got)
+		}
+		if Exists(filepath.Join(dst, "boot")) {
+			t.Errorf("%q. ExtractMatching() extracted the boot folder", filepath.Base(src))
+		}
+
+		var buf bytes.Buffer
+		entry, err := ExtractMatchingTo(context.Background(), src, []string{"config.txt"}, &buf)
+		if err != nil || entry.Name != "boot/config.txt" || buf.String() != "dtparam=audio=on" {
+			t.Errorf("%q. ExtractMatchingTo() = %v, %q, %v", filepath.Base(src), entry, buf.String(), err)
+		}
+
+		if _, err := ExtractMatching(context.Background(), src, []string{"*.iso"}, dst); !errors.Is(err, ErrNoMatch) {
+			t.Errorf("%q. ExtractMatching() error = %v, want ErrNoMatch", filepath.Base(src), err)
+		}
+	}
+}
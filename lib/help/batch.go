@@ -0,0 +1,257 @@
+package help
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Artifact is a file downloaded by a batch
+type Artifact struct {
+	URL string
+	// Destination is the folder of the file
+	Destination string
+	// FileName overrides the name taken from the response or the url
+	FileName string
+	// Digest is the expected hash sum, the checksum settings of the batch downloader are used when it's zero
+	Digest Digest
+}
+
+// ArtifactResult is the outcome of an artifact download
+type ArtifactResult struct {
+	Artifact Artifact
+	// File is the path of the downloaded file
+	File string
+	// Duplicate is set when the file was copied, or linked with HardLink, from another artifact with the same url
+	Duplicate bool
+	Duration  time.Duration
+	Err       error
+}
+
+// BatchEvent is a progress event of an artifact along with the overall progress of the batch
+type BatchEvent struct {
+	ProgressEvent
+	// Item is the index of the artifact
+	Item int
+	// BatchDone and BatchTotal sum bytes of all the artifacts, lengths are added once downloads start
+	BatchDone  int64
+	BatchTotal int64
+	// Finished and Failed count completed artifacts out of Count
+	Finished int
+	Failed   int
+	Count    int
+}
+
+// BatchReporter receives progress events of a batch one at a time
+type BatchReporter interface {
+	ReportBatch(e BatchEvent)
+}
+
+// BatchFunc is a function used as a BatchReporter
+type BatchFunc func(e BatchEvent)
+
+// ReportBatch implements BatchReporter
+func (f BatchFunc) ReportBatch(e BatchEvent) {
+	f(e)
+}
+
+// Batch downloads artifacts concurrently, every unique url is downloaded once
+type Batch struct {
+	// Downloader is the template of all the downloads: its client, retries, cache and credentials are shared
+	Downloader *Downloader
+	// Workers limits the number of concurrent downloads, values below 1 mean a single worker
+	Workers int
+	// Progress receives events of all the artifacts, the console is used when it's nil
+	// unless the downloader is quiet
+	Progress BatchReporter
+	// HardLink links files of duplicate urls to the downloaded file instead of copying them.
+	// The files must not be modified in place then, as all the links change too
+	HardLink bool
+}
+
+// NewBatch returns a batch of the default downloader with the workers limit
+func NewBatch(workers int) *Batch {
+	return &Batch{Downloader: NewDownloader(), Workers: workers}
+}
+
+// batchProgress aggregates events of the artifacts
+type batchProgress struct {
+	reporter BatchReporter
+
+	mu       sync.Mutex
+	done     []int64
+	totals   []int64
+	finished int
+	failed   int
+}
+
+func (p *batchProgress) report(item int, e ProgressEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch e.Type {
+	case ProgressStarted, ProgressBytes:
+		p.done[item] = e.Done
+		if e.Total > 0 {
+			p.totals[item] = e.Total
+		}
+	case ProgressFinished:
+		p.finished++
+		p.done[item] = p.totals[item]
+	case ProgressFailed:
+		p.failed++
+	}
+
+	be := BatchEvent{
+		ProgressEvent: e,
+		Item:          item,
+		Finished:      p.finished,
+		Failed:        p.failed,
+		Count:         len(p.done),
+	}
+	for i := range p.done {
+		be.BatchDone += p.done[i]
+		be.BatchTotal += p.totals[i]
+	}
+	if p.reporter != nil {
+		p.reporter.ReportBatch(be)
+	}
+}
+
+// Run downloads the artifacts and returns their results in the same order. Failures don't stop
+// the other downloads, cancelling the context does
+func (b *Batch) Run(ctx context.Context, artifacts []Artifact) []ArtifactResult {
+	template := b.Downloader
+	if template == nil {
+		template = NewDownloader()
+	}
+	reporter := b.Progress
+	if reporter == nil && !template.Quiet {
+		reporter = NewConsoleBatchReporter()
+	}
+
+	results := make([]ArtifactResult, len(artifacts))
+	progress := &batchProgress{
+		reporter: reporter,
+		done:     make([]int64, len(artifacts)),
+		totals:   make([]int64, len(artifacts)),
+	}
+
+	// artifacts with the same url wait for the first one
+	var (
+		unique     []int
+		duplicates = make(map[int][]int)
+		firsts     = make(map[string]int)
+	)
+	for i, a := range artifacts {
+		results[i].Artifact = a
+		if first, ok := firsts[a.URL]; ok {
+			duplicates[first] = append(duplicates[first], i)
+			continue
+		}
+		firsts[a.URL] = i
+		unique = append(unique, i)
+	}
+
+	workers := b.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				b.download(ctx, template, i, &results[i], progress)
+				for _, dup := range duplicates[i] {
+					b.duplicate(&results[i], &results[dup], dup, progress)
+				}
+			}
+		}()
+	}
+
+	for _, i := range unique {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+func (b *Batch) download(ctx context.Context, template *Downloader, item int, result *ArtifactResult, progress *batchProgress) {
+	started := time.Now()
+	defer func() {
+		result.Duration = time.Since(started)
+	}()
+
+	d := *template
+	d.FileName = result.Artifact.FileName
+	if !result.Artifact.Digest.IsZero() {
+		d.Digest = result.Artifact.Digest
+	}
+	d.Progress = ProgressFunc(func(e ProgressEvent) {
+		progress.report(item, e)
+	})
+
+	if ctx.Err() != nil {
+		result.Err = ctx.Err()
+		progress.report(item, ProgressEvent{Type: ProgressFailed, URL: result.Artifact.URL, Err: result.Err})
+		return
+	}
+
+	fileName, err := d.Download(ctx, result.Artifact.URL, result.Artifact.Destination)
+	if err != nil {
+		log.WithField("url", redactURL(result.Artifact.URL)).Error("Batch download failed: ", err.Error())
+		result.Err = err
+		return
+	}
+	result.File = filepath.Join(result.Artifact.Destination, fileName)
+}
+
+// duplicate places the file of the first artifact with the same url at the destination of the dup
+func (b *Batch) duplicate(first, dup *ArtifactResult, item int, progress *batchProgress) {
+	dup.Duplicate = true
+
+	event := ProgressEvent{Type: ProgressFinished, URL: dup.Artifact.URL, Cached: true}
+	defer func() {
+		if dup.Err != nil {
+			event.Type, event.Err = ProgressFailed, dup.Err
+		}
+		progress.report(item, event)
+	}()
+
+	if first.Err != nil {
+		dup.Err = first.Err
+		return
+	}
+
+	fileName := dup.Artifact.FileName
+	if fileName == "" {
+		fileName = filepath.Base(first.File)
+	}
+	dup.File = filepath.Join(dup.Artifact.Destination, fileName)
+	event.File = dup.File
+
+	if !dup.Artifact.Digest.IsZero() {
+		if dup.Err = VerifyFile(first.File, dup.Artifact.Digest); dup.Err != nil {
+			return
+		}
+	}
+	if dup.File == first.File {
+		return
+	}
+	if dup.Err = CreateDir(dup.Artifact.Destination); dup.Err != nil {
+		return
+	}
+	if b.HardLink {
+		dup.Err = replaceWithLink(first.File, dup.File)
+		return
+	}
+	dup.Err = replaceWithCopy(first.File, dup.File)
+}
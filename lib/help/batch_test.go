@@ -0,0 +1,126 @@
+package help
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatchRun(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests = make(map[string]int)
+		active   int
+		maxSeen  int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if r.Method == http.MethodGet {
+			requests[r.URL.Path]++
+		}
+		active++
+		if active > maxSeen {
+			maxSeen = active
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			active--
+			mu.Unlock()
+		}()
+
+		if r.URL.Path == "/missing.img" {
+			http.NotFound(w, r)
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, bytes.NewReader([]byte(r.URL.Path)))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sum := sha256.Sum256([]byte("/b.img"))
+	artifacts := []Artifact{
+		{URL: srv.URL + "/a.img", Destination: filepath.Join(dir, "1")},
+		{URL: srv.URL + "/b.img", Destination: filepath.Join(dir, "1"), Digest: Digest{Algorithm: SHA256, Sum: sum[:]}},
+		{URL: srv.URL + "/missing.img", Destination: filepath.Join(dir, "1")},
+		{URL: srv.URL + "/a.img", Destination: filepath.Join(dir, "2")},
+		{URL: srv.URL + "/c.img", Destination: filepath.Join(dir, "1")},
+	}
+
+	var last BatchEvent
+	b := NewBatch(2)
+	b.Progress = BatchFunc(func(e BatchEvent) {
+		last = e
+	})
+	results := b.Run(context.Background(), artifacts)
+
+	for i, r := range results {
+		if (r.Err != nil) != (i == 2) {
+			t.Errorf("%q. Run() error = %v", r.Artifact.URL, r.Err)
+		}
+	}
+	if !results[3].Duplicate || results[3].File != filepath.Join(dir, "2", "a.img") {
+		t.Errorf("Run() duplicate result = %+v", results[3])
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "2", "a.img")); err != nil || string(b) != "/a.img" {
+		t.Errorf("Duplicate file content = %q, %v", b, err)
+	}
+	if sameFile(filepath.Join(dir, "1", "a.img"), filepath.Join(dir, "2", "a.img")) {
+		t.Error("Duplicate file is linked without HardLink")
+	}
+	if requests["/a.img"] != 1 {
+		t.Errorf("Duplicate url requested %d times, want once", requests["/a.img"])
+	}
+	if maxSeen > 2 {
+		t.Errorf("%d concurrent requests, want at most 2", maxSeen)
+	}
+	if last.Finished != 4 || last.Failed != 1 || last.Count != 5 {
+		t.Errorf("Last event = %+v, want 4 finished and 1 failed of 5", last)
+	}
+	if want := int64(len("/a.img") + len("/b.img") + len("/c.img")); last.BatchDone != want || last.BatchTotal != want {
+		t.Errorf("Last event batch bytes = %d of %d, want %d", last.BatchDone, last.BatchTotal, want)
+	}
+}
+
+func TestBatchHardLink(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("image"))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := NewBatch(1)
+	b.Downloader.Quiet = true
+	b.HardLink = true
+	results := b.Run(context.Background(), []Artifact{
+		{URL: srv.URL + "/a.img", Destination: filepath.Join(dir, "1")},
+		{URL: srv.URL + "/a.img", Destination: filepath.Join(dir, "2")},
+	})
+	for _, r := range results {
+		if r.Err != nil {
+			t.Fatalf("%q. Run() error = %v", r.Artifact.URL, r.Err)
+		}
+	}
+	if !sameFile(results[0].File, results[1].File) {
+		t.Error("Duplicate file should be linked with HardLink")
+	}
+}
@@ -0,0 +1,610 @@
+package help
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	cacheIndexFile = "index.json"
+	cacheLockFile  = "index.lock"
+)
+
+// Cache is a content addressed store of downloaded files, blobs are copied into destinations
+// and verified against their digests. The index is keyed by url and keeps the digest and
+// http validators of every blob, it's shared safely by several processes
+type Cache struct {
+	// Dir is the root of the cache, blobs are stored under Dir/blobs/<algorithm>/<hex>
+	Dir string
+	// MaxSize is the disk budget in bytes, least recently used entries are evicted
+	// when it's exceeded. Zero means unlimited
+	MaxSize int64
+	// HardLink links blobs into destinations when possible so the same image is stored on disk once.
+	// The destinations must not be modified in place then, as the blob and the other destinations change too
+	HardLink bool
+
+	mu sync.Mutex
+}
+
+// CacheEntry describes a cached url
+type CacheEntry struct {
+	// URL is the url without the user and password
+	URL          string    `json:"url"`
+	Digest       string    `json:"digest"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Created      time.Time `json:"created"`
+	LastUsed     time.Time `json:"last_used"`
+}
+
+// NewCache creates the cache directory and returns a cache limited by maxSize bytes
+func NewCache(dir string, maxSize int64) (*Cache, error) {
+	if err := CreateDir(filepath.Join(dir, "blobs")); err != nil {
+		return nil, err
+	}
+	return &Cache{Dir: dir, MaxSize: maxSize}, nil
+}
+
+// DefaultCacheDir returns the per-user cache location
+func DefaultCacheDir() string {
+	return filepath.Join(UserHomeDir(), ".cache", "xshellinc")
+}
+
+func (c *Cache) blobPath(digest string) string {
+	d, err := ParseDigest(digest)
+	if err != nil {
+		return filepath.Join(c.Dir, "blobs", "invalid")
+	}
+	return filepath.Join(c.Dir, "blobs", d.Algorithm, hex.EncodeToString(d.Sum))
+}
+
+func (c *Cache) load() (map[string]*CacheEntry, error) {
+	index := make(map[string]*CacheEntry)
+
+	b, err := ioutil.ReadFile(filepath.Join(c.Dir, cacheIndexFile))
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &index); err != nil {
+		log.Error("Cache index is corrupted, starting from scratch: ", err.Error())
+		return make(map[string]*CacheEntry), nil
+	}
+
+	return index, nil
+}
+
+// save writes the index atomically
+func (c *Cache) save(index map[string]*CacheEntry) error {
+	b, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(c.Dir, cacheIndexFile+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(c.Dir, cacheIndexFile))
+}
+
+// lock serializes the index updates of goroutines and of processes sharing the cache
+func (c *Cache) lock() (func(), error) {
+	c.mu.Lock()
+	f, err := os.OpenFile(filepath.Join(c.Dir, cacheLockFile), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		c.mu.Unlock()
+		return nil, err
+	}
+
+	return func() {
+		unlockFile(f)
+		f.Close()
+		c.mu.Unlock()
+	}, nil
+}
+
+// Lookup returns the entry of the url if its blob is present
+func (c *Cache) Lookup(rawurl string) (*CacheEntry, bool) {
+	unlock, err := c.lock()
+	if err != nil {
+		return nil, false
+	}
+	defer unlock()
+
+	index, err := c.load()
+	if err != nil {
+		return nil, false
+	}
+	e, ok := index[cacheKey(rawurl)]
+	if !ok || !Exists(c.blobPath(e.Digest)) {
+		return nil, false
+	}
+
+	return e, true
+}
+
+// LookupDigest returns any entry with the digest, so the same file from a different url is reused.
+// The blob is verified when it's placed by Link
+func (c *Cache) LookupDigest(digest Digest) (*CacheEntry, bool) {
+	unlock, err := c.lock()
+	if err != nil {
+		return nil, false
+	}
+	defer unlock()
+
+	index, err := c.load()
+	if err != nil {
+		return nil, false
+	}
+	for _, e := range index {
+		if e.Digest == digest.String() && Exists(c.blobPath(e.Digest)) {
+			return e, true
+		}
+	}
+
+	return nil, false
+}
+
+// Put stores a copy of the file under the url, with HardLink the file itself is linked to the blob.
+// The digest is computed if it's not known
+func (c *Cache) Put(rawurl, file string, digest Digest, header http.Header) (*CacheEntry, error) {
+	if digest.IsZero() {
+		var err error
+		if digest, err = HashFile(file, SHA256); err != nil {
+			return nil, err
+		}
+	}
+
+	blob := c.blobPath(digest.String())
+	if err := CreateDir(filepath.Dir(blob)); err != nil {
+		return nil, err
+	}
+	// large files are copied before locking the cache
+	var tmp string
+	if !c.HardLink && !Exists(blob) {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		tmp, err = copyTemp(f, filepath.Dir(blob), nil)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(tmp)
+	}
+
+	unlock, err := c.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	switch {
+	case Exists(blob):
+		if c.HardLink {
+			if err := replaceWithLink(blob, file); err != nil {
+				log.Debug("Unable to link cached blob ", blob, " to ", file, ": ", err.Error())
+			}
+		}
+	case tmp != "":
+		err = os.Rename(tmp, blob)
+	case c.HardLink:
+		err = linkOrCopy(file, blob)
+	default:
+		// the blob was evicted by another process after it was checked
+		err = Copy(file, blob)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := GetFileLength(blob)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	e := &CacheEntry{
+		URL:      cacheKey(rawurl),
+		Digest:   digest.String(),
+		Size:     size,
+		Created:  now,
+		LastUsed: now,
+	}
+	if header != nil {
+		e.ETag = header.Get("ETag")
+		e.LastModified = header.Get("Last-Modified")
+	} else if old, ok := index[e.URL]; ok && old.Digest == e.Digest {
+		e.ETag, e.LastModified, e.Created = old.ETag, old.LastModified, old.Created
+	}
+	index[e.URL] = e
+
+	if err := c.evict(index); err != nil {
+		return nil, err
+	}
+
+	return e, c.save(index)
+}
+
+// Link places a copy of the blob of the entry at dst, or a hard link with HardLink, and marks
+// the entry as used. The size and the digest of the blob are verified before, a corrupted blob
+// is removed from the cache and *ChecksumError is returned
+func (c *Cache) Link(e *CacheEntry, dst string) error {
+	if err := CreateDir(filepath.Dir(dst)); err != nil {
+		return err
+	}
+	digest, err := ParseDigest(e.Digest)
+	if err != nil {
+		return err
+	}
+
+	blob, err := c.use(e)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	info, err := blob.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() != e.Size {
+		c.discard(e.Digest)
+		return fmt.Errorf("cached blob %s has %d bytes, expected %d", blob.Name(), info.Size(), e.Size)
+	}
+
+	h, _ := digest.newHash()
+	var tmp string
+	if c.HardLink {
+		_, err = io.Copy(h, blob)
+	} else {
+		tmp, err = copyTemp(blob, filepath.Dir(dst), h)
+	}
+	if err != nil {
+		return err
+	}
+	if tmp != "" {
+		defer os.Remove(tmp)
+	}
+
+	actual := Digest{Algorithm: digest.Algorithm, Sum: h.Sum(nil)}
+	if !actual.Equal(digest) {
+		c.discard(e.Digest)
+		return &ChecksumError{File: blob.Name(), Expected: digest, Actual: actual}
+	}
+	if c.HardLink {
+		return replaceWithLink(blob.Name(), dst)
+	}
+	return os.Rename(tmp, dst)
+}
+
+// use opens the blob of the entry and marks the entry as used
+func (c *Cache) use(e *CacheEntry) (*os.File, error) {
+	unlock, err := c.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// an open blob can be read even if another process evicts it
+	blob, err := os.Open(c.blobPath(e.Digest))
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := c.load()
+	if err != nil {
+		blob.Close()
+		return nil, err
+	}
+	if ie, ok := index[e.URL]; ok {
+		ie.LastUsed = time.Now()
+	}
+	if err := c.save(index); err != nil {
+		blob.Close()
+		return nil, err
+	}
+
+	return blob, nil
+}
+
+// discard removes the corrupted blob and its entries
+func (c *Cache) discard(digest string) {
+	log.Error("Cached blob ", digest, " is corrupted, removing it")
+	unlock, err := c.lock()
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	index, err := c.load()
+	if err != nil {
+		return
+	}
+	for url, e := range index {
+		if e.Digest == digest {
+			delete(index, url)
+		}
+	}
+	c.removeBlob(index, digest)
+	c.save(index)
+}
+
+// Remove deletes the entry of the url and its blob if no other entry refers to it
+func (c *Cache) Remove(rawurl string) error {
+	unlock, err := c.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	index, err := c.load()
+	if err != nil {
+		return err
+	}
+	if e, ok := index[cacheKey(rawurl)]; ok {
+		delete(index, e.URL)
+		c.removeBlob(index, e.Digest)
+	}
+
+	return c.save(index)
+}
+
+// Evict removes least recently used entries until the cache fits into MaxSize
+func (c *Cache) Evict() error {
+	unlock, err := c.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	index, err := c.load()
+	if err != nil {
+		return err
+	}
+	if err := c.evict(index); err != nil {
+		return err
+	}
+
+	return c.save(index)
+}
+
+func (c *Cache) evict(index map[string]*CacheEntry) error {
+	if c.MaxSize <= 0 {
+		return nil
+	}
+
+	// blobs shared by several urls are counted once
+	var (
+		total   int64
+		entries = make([]*CacheEntry, 0, len(index))
+		blobs   = make(map[string]bool)
+	)
+	for _, e := range index {
+		entries = append(entries, e)
+		if !blobs[e.Digest] {
+			blobs[e.Digest] = true
+			total += e.Size
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.Before(entries[j].LastUsed)
+	})
+
+	for _, e := range entries {
+		if total <= c.MaxSize {
+			break
+		}
+		log.Debug("Evicting cached ", e.URL)
+		delete(index, e.URL)
+		if c.removeBlob(index, e.Digest) {
+			total -= e.Size
+		}
+	}
+
+	return nil
+}
+
+// removeBlob deletes the blob if it's not referenced by the index anymore
+func (c *Cache) removeBlob(index map[string]*CacheEntry, digest string) bool {
+	for _, e := range index {
+		if e.Digest == digest {
+			return false
+		}
+	}
+
+	return DeleteFile(c.blobPath(digest)) == nil
+}
+
+// linkOrCopy hard links src to dst, copies the file when linking isn't possible
+func linkOrCopy(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	return Copy(src, dst)
+}
+
+// copyTemp copies r into a temporary file of the dir, w receives the data too if it's set
+func copyTemp(r io.Reader, dir string, w io.Writer) (string, error) {
+	tmp, err := ioutil.TempFile(dir, ".cache-")
+	if err != nil {
+		return "", err
+	}
+	if w != nil {
+		r = io.TeeReader(r, w)
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	// temporary files are private
+	os.Chmod(tmp.Name(), 0644)
+	return tmp.Name(), nil
+}
+
+// sameFile returns true if both paths point to the same file
+func sameFile(a, b string) bool {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bi, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(ai, bi)
+}
+
+// replaceWithLink atomically replaces dst with a link or a copy of src
+func replaceWithLink(src, dst string) error {
+	if sameFile(src, dst) {
+		return nil
+	}
+
+	tmp := dst + ".tmp"
+	DeleteFile(tmp)
+	if err := linkOrCopy(src, tmp); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, dst)
+}
+
+// replaceWithCopy atomically replaces dst with a copy of src
+func replaceWithCopy(src, dst string) error {
+	if sameFile(src, dst) {
+		return nil
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tmp, err := copyTemp(f, filepath.Dir(dst), nil)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// cacheKey is the url without the user and password, which aren't stored in the index
+func cacheKey(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.User == nil {
+		return rawurl
+	}
+	u.User = nil
+	return u.String()
+}
+
+// fromCache places a fresh cached copy of the url at dst. An entry is fresh when it matches
+// the expected digest or the server confirms its validators
+func (d *Downloader) fromCache(ctx context.Context, rawurl string, digest Digest, dst string) bool {
+	e, ok := d.Cache.Lookup(rawurl)
+	switch {
+	case !digest.IsZero():
+		if !ok || e.Digest != digest.String() {
+			e, ok = d.Cache.LookupDigest(digest)
+		}
+	case ok:
+		ok = d.revalidate(ctx, rawurl, e)
+	}
+
+	if !ok {
+		return false
+	}
+	if err := d.Cache.Link(e, dst); err != nil {
+		log.Error("Error linking cached file ", dst, " error msg:", err.Error())
+		return false
+	}
+
+	return true
+}
+
+// revalidate makes a conditional request to the url of the entry, files of other sources are
+// compared by Stat. Entries without validators are always stale
+func (d *Downloader) revalidate(ctx context.Context, rawurl string, e *CacheEntry) bool {
+	if e.ETag == "" && e.LastModified == "" {
+		return false
+	}
+	if !isHTTP(rawurl) {
+		info, err := d.RemoteInfo(ctx, rawurl)
+		return err == nil && info.ETag == e.ETag && info.LastModified == e.LastModified
+	}
+
+	header := http.Header{}
+	if e.ETag != "" {
+		header.Set("If-None-Match", e.ETag)
+	}
+	if e.LastModified != "" {
+		header.Set("If-Modified-Since", e.LastModified)
+	}
+
+	resp, err := d.request(ctx, http.MethodHead, rawurl, header)
+	if err != nil {
+		log.Debug("Unable to revalidate cached ", e.URL, ": ", err.Error())
+		return false
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode == http.StatusNotModified
+}
+
+// toCache stores the downloaded file, errors are only logged as the download itself succeeded
+func (d *Downloader) toCache(rawurl, file string, digest Digest, header http.Header) {
+	if e, ok := d.Cache.Lookup(rawurl); ok && header == nil && sameFile(d.Cache.blobPath(e.Digest), file) {
+		return
+	}
+	if _, err := d.Cache.Put(rawurl, file, digest, header); err != nil {
+		log.Error("Error caching ", redactURL(rawurl), " error msg:", err.Error())
+	}
+}
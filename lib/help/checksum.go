@@ -0,0 +1,303 @@
+package help
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Supported digest algorithms
+const (
+	SHA256 = "sha256"
+	SHA512 = "sha512"
+)
+
+// Digest is an expected hash sum of a file
+type Digest struct {
+	Algorithm string
+	Sum       []byte
+}
+
+// ChecksumError is returned when a downloaded file doesn't match the expected digest
+type ChecksumError struct {
+	File     string
+	Expected Digest
+	Actual   Digest
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch of %s: expected %s got %s", e.File, e.Expected, e.Actual)
+}
+
+// ParseDigest parses digests in the `algorithm:hex` form, algorithm of a bare hex string
+// is detected by its length
+func ParseDigest(s string) (Digest, error) {
+	var d Digest
+
+	s = strings.TrimSpace(s)
+	if i := strings.Index(s, ":"); i > -1 {
+		d.Algorithm = strings.ToLower(strings.Replace(s[:i], "-", "", -1))
+		s = s[i+1:]
+	}
+
+	sum, err := hex.DecodeString(s)
+	if err != nil {
+		return d, fmt.Errorf("invalid digest %q: %s", s, err.Error())
+	}
+	d.Sum = sum
+
+	switch {
+	case d.Algorithm == "" && len(sum) == sha256.Size:
+		d.Algorithm = SHA256
+	case d.Algorithm == "" && len(sum) == sha512.Size:
+		d.Algorithm = SHA512
+	}
+
+	h, err := d.newHash()
+	if err != nil {
+		return d, err
+	}
+	if h.Size() != len(sum) {
+		return d, fmt.Errorf("invalid %s digest length %d", d.Algorithm, len(sum))
+	}
+
+	return d, nil
+}
+
+// IsZero returns true if the digest is not set
+func (d Digest) IsZero() bool {
+	return len(d.Sum) == 0
+}
+
+// Equal compares digests including their algorithms
+func (d Digest) Equal(o Digest) bool {
+	return d.Algorithm == o.Algorithm && bytes.Equal(d.Sum, o.Sum)
+}
+
+func (d Digest) String() string {
+	return d.Algorithm + ":" + hex.EncodeToString(d.Sum)
+}
+
+func (d Digest) newHash() (hash.Hash, error) {
+	switch d.Algorithm {
+	case SHA256:
+		return sha256.New(), nil
+	case SHA512:
+		return sha512.New(), nil
+	}
+
+	return nil, fmt.Errorf("unsupported digest algorithm %q", d.Algorithm)
+}
+
+// HashFile returns the digest of the file with the algorithm
+func HashFile(filePath, algorithm string) (Digest, error) {
+	d := Digest{Algorithm: algorithm}
+
+	h, err := d.newHash()
+	if err != nil {
+		return d, err
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return d, err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(h, file); err != nil {
+		return d, err
+	}
+	d.Sum = h.Sum(nil)
+
+	return d, nil
+}
+
+// VerifyFile compares the digest of the file with the expected one, returns *ChecksumError on mismatch
+func VerifyFile(filePath string, expected Digest) error {
+	actual, err := HashFile(filePath, expected.Algorithm)
+	if err != nil {
+		return err
+	}
+	if !actual.Equal(expected) {
+		return &ChecksumError{File: filePath, Expected: expected, Actual: actual}
+	}
+
+	return nil
+}
+
+// ParseChecksums finds the digest of the file in a checksum file such as SHA256SUMS,
+// both GNU `<hex>  <name>` and BSD `SHA256 (<name>) = <hex>` lines are supported
+func ParseChecksums(r io.Reader, fileName string) (Digest, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var alg, name, sum string
+		if i := strings.Index(line, " ("); i > 0 && strings.Contains(line, ") = ") {
+			// BSD style
+			alg = line[:i]
+			name = line[i+2 : strings.LastIndex(line, ") = ")]
+			sum = line[strings.LastIndex(line, ") = ")+4:]
+		} else {
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				continue
+			}
+			sum = fields[0]
+			name = strings.TrimPrefix(strings.Join(fields[1:], " "), "*")
+		}
+
+		if name != fileName && filepath.Base(name) != fileName {
+			continue
+		}
+
+		if alg != "" {
+			sum = alg + ":" + sum
+		}
+		return ParseDigest(sum)
+	}
+	if err := scanner.Err(); err != nil {
+		return Digest{}, err
+	}
+
+	return Digest{}, errors.New("no checksum found for " + fileName)
+}
+
+// ChecksumFromURL downloads a checksum file and returns the digest of the fileName
+func (d *Downloader) ChecksumFromURL(ctx context.Context, checksumURL, fileName string) (Digest, error) {
+	b, err := d.fetchSmall(ctx, checksumURL, 1024*1024)
+	if err != nil {
+		return Digest{}, err
+	}
+
+	return ParseChecksums(bytes.NewReader(b), fileName)
+}
+
+// fetchSmall reads up to the limit of a small file such as a checksum file or a signature,
+// retrying transient errors according to the retry policy
+func (d *Downloader) fetchSmall(ctx context.Context, rawurl string, limit int64) ([]byte, error) {
+	policy := d.retryPolicy()
+	started := time.Now()
+	for attempt := 1; ; attempt++ {
+		b, err := d.readSmall(ctx, rawurl, limit)
+		if err == nil {
+			return b, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		delay, retry := policy.Next(attempt, time.Since(started), err)
+		if !retry {
+			return nil, err
+		}
+		log.WithField("url", redactURL(rawurl)).WithField("attempt", attempt).Debug("Fetch failed: ", err.Error())
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (d *Downloader) readSmall(ctx context.Context, rawurl string, limit int64) ([]byte, error) {
+	resp, err := d.get(ctx, rawurl, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return ioutil.ReadAll(io.LimitReader(resp.Body, limit))
+}
+
+// expectedDigest returns the Digest of the downloader or looks it up in the ChecksumURL
+func (d *Downloader) expectedDigest(ctx context.Context, fileName string) (Digest, error) {
+	if !d.Digest.IsZero() || d.ChecksumURL == "" {
+		return d.Digest, nil
+	}
+
+	digest, err := d.ChecksumFromURL(ctx, d.ChecksumURL, fileName)
+	if err != nil {
+		log.Error("Error getting checksum from:", redactURL(d.ChecksumURL), " error msg:", err.Error())
+	}
+
+	return digest, err
+}
+
+// verify checks the digest and the signature of the downloaded file, the streamed hash is used
+// instead of reading the file again when it's set. Files which don't match are rejected,
+// other errors such as a failed fetch of the signature leave the file in place
+func (d *Downloader) verify(ctx context.Context, file string, digest Digest, streamed hash.Hash) error {
+	if !digest.IsZero() {
+		var err error
+		if streamed != nil {
+			actual := Digest{Algorithm: digest.Algorithm, Sum: streamed.Sum(nil)}
+			if !actual.Equal(digest) {
+				err = &ChecksumError{File: file, Expected: digest, Actual: actual}
+			}
+		} else {
+			err = VerifyFile(file, digest)
+		}
+		if err != nil {
+			if isMismatch(err) {
+				d.reject(file)
+			}
+			return err
+		}
+	}
+
+	if d.Verifier == nil {
+		return nil
+	}
+	if d.SignatureURL == "" {
+		return errors.New("signature url is not set")
+	}
+
+	signature, err := d.fetchSmall(ctx, d.SignatureURL, 64*1024)
+	if err != nil {
+		return err
+	}
+	if err := d.Verifier.Verify(file, signature); err != nil {
+		if isMismatch(err) {
+			d.reject(file)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// isMismatch returns true for errors of files which don't match their digest or signature
+func isMismatch(err error) bool {
+	var checksumErr *ChecksumError
+	return errors.As(err, &checksumErr) || errors.Is(err, ErrSignature)
+}
+
+// reject moves the file into the QuarantineDir or deletes it
+func (d *Downloader) reject(file string) {
+	if d.QuarantineDir != "" && CreateDir(d.QuarantineDir) == nil {
+		dst := filepath.Join(d.QuarantineDir, fmt.Sprintf("%s.%d", filepath.Base(file), time.Now().Unix()))
+		if err := os.Rename(file, dst); err == nil {
+			log.Warn("File failed verification, moved to ", dst)
+			return
+		}
+	}
+
+	log.Warn("File failed verification, deleting ", file)
+	DeleteFile(file)
+}
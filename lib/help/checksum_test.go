@@ -0,0 +1,187 @@
+package help
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+func TestParseChecksums(t *testing.T) {
+	sum := sha256.Sum256([]byte("image"))
+	hexSum := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name    string
+		sums    string
+		file    string
+		wantErr bool
+	}{
+		{"gnu", "0000000000000000000000000000000000000000000000000000000000000000  other.img\n" + hexSum + "  raspbian.img.xz\n", "raspbian.img.xz", false},
+		{"binary", hexSum + " *dir/raspbian.img.xz\n", "raspbian.img.xz", false},
+		{"bsd", "SHA256 (raspbian.img.xz) = " + hexSum + "\n", "raspbian.img.xz", false},
+		{"missing", hexSum + "  other.img\n", "raspbian.img.xz", true},
+	}
+	for _, tt := range tests {
+		d, err := ParseChecksums(strings.NewReader(tt.sums), tt.file)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q. ParseChecksums() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (d.Algorithm != SHA256 || !bytes.Equal(d.Sum, sum[:])) {
+			t.Errorf("%q. ParseChecksums() = %s", tt.name, d)
+		}
+	}
+}
+
+func TestDownloaderChecksumMismatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader("tampered"))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "checksum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sum := sha256.Sum256([]byte("image"))
+	d := NewDownloader()
+	d.Quiet = true
+	d.Digest = Digest{Algorithm: SHA256, Sum: sum[:]}
+	d.QuarantineDir = filepath.Join(dir, "quarantine")
+
+	_, err = d.Download(context.Background(), srv.URL+"/test.img", dir)
+	if _, ok := err.(*ChecksumError); !ok {
+		t.Fatalf("Download() error = %v, want *ChecksumError", err)
+	}
+	if Exists(filepath.Join(dir, "test.img")) {
+		t.Error("File with a wrong checksum should be removed")
+	}
+	if files, _ := ioutil.ReadDir(d.QuarantineDir); len(files) != 1 {
+		t.Error("File with a wrong checksum should be quarantined")
+	}
+}
+
+func TestDownloaderSignatureRetry(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sigRequests, sigFailures int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/test.img.sig" {
+			if atomic.AddInt32(&sigRequests, 1) <= atomic.LoadInt32(&sigFailures) {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			w.Write(ed25519.Sign(priv, []byte("image")))
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader("image"))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "signature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := NewDownloader()
+	d.Quiet = true
+	d.Verifier, _ = NewEd25519Verifier(pub)
+	d.SignatureURL = srv.URL + "/test.img.sig"
+	d.RetryPolicy = &Backoff{MaxAttempts: 2}
+
+	// a transient error of the signature is retried
+	atomic.StoreInt32(&sigFailures, 1)
+	if _, err := d.Download(context.Background(), srv.URL+"/test.img", dir); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if n := atomic.LoadInt32(&sigRequests); n != 2 {
+		t.Errorf("Signature requested %d times, want 2", n)
+	}
+
+	// the verified file isn't deleted when the signature can't be fetched
+	atomic.StoreInt32(&sigRequests, 0)
+	atomic.StoreInt32(&sigFailures, 100)
+	if _, err := d.Download(context.Background(), srv.URL+"/test.img", dir); err == nil {
+		t.Error("Download() without a signature succeeded")
+	}
+	if !Exists(filepath.Join(dir, "test.img")) {
+		t.Error("File should be kept when the signature can't be fetched")
+	}
+}
+
+func TestMinisignVerifier(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := []byte("12345678")
+	message := []byte("image")
+
+	f, err := ioutil.TempFile("", "minisign")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Write(message)
+	f.Close()
+
+	sig := append(append([]byte("Ed"), id...), ed25519.Sign(priv, message)...)
+	trusted := "timestamp:0"
+	global := ed25519.Sign(priv, append(sig[10:], trusted...))
+	signature := "untrusted comment: test\n" +
+		base64.StdEncoding.EncodeToString(sig) + "\n" +
+		"trusted comment: " + trusted + "\n" +
+		base64.StdEncoding.EncodeToString(global) + "\n"
+
+	v, err := NewMinisignVerifier("untrusted comment: test\n" +
+		base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), id...), pub...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Verify(f.Name(), []byte(signature)); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+	if err := v.Verify(f.Name(), []byte(strings.Replace(signature, trusted, "timestamp:1", 1))); err != ErrSignature {
+		t.Errorf("Verify() of a modified trusted comment error = %v, want %v", err, ErrSignature)
+	}
+
+	// legacy signatures of large files aren't read into memory
+	maxSignedSize = int64(len(message)) - 1
+	defer func() { maxSignedSize = 64 * 1024 * 1024 }()
+	if err := v.Verify(f.Name(), []byte(signature)); err != ErrSignedTooLarge {
+		t.Errorf("Verify() of a large file error = %v, want %v", err, ErrSignedTooLarge)
+	}
+	hashed := blake2b.Sum512(message)
+	sig = append(append([]byte("ED"), id...), ed25519.Sign(priv, hashed[:])...)
+	global = ed25519.Sign(priv, append(sig[10:], trusted...))
+	prehashed := "untrusted comment: test\n" +
+		base64.StdEncoding.EncodeToString(sig) + "\n" +
+		"trusted comment: " + trusted + "\n" +
+		base64.StdEncoding.EncodeToString(global) + "\n"
+	if err := v.Verify(f.Name(), []byte(prehashed)); err != nil {
+		t.Errorf("Verify() of a prehashed signature error = %v", err)
+	}
+	raw, _ := NewEd25519Verifier(pub)
+	if err := raw.Verify(f.Name(), ed25519.Sign(priv, message)); err != ErrSignedTooLarge {
+		t.Errorf("Verify() of a large file error = %v, want %v", err, ErrSignedTooLarge)
+	}
+}
@@ -0,0 +1,248 @@
+package help
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Credentials authorize requests of a downloader. They are applied to the requested url
+// and to redirects to the same host, but never forwarded to other hosts
+type Credentials interface {
+	// Authorize adds credentials to the request
+	Authorize(req *http.Request) error
+}
+
+// CredentialsRefresher is implemented by credentials which are renewed when a server responds
+// with 401 Unauthorized, the request is repeated once after the refresh
+type CredentialsRefresher interface {
+	Refresh(ctx context.Context) error
+}
+
+// HeaderCredentials sets a static header such as a private token
+type HeaderCredentials struct {
+	Name  string
+	Value string
+}
+
+// BearerToken returns credentials sending the Authorization: Bearer header
+func BearerToken(token string) *HeaderCredentials {
+	return &HeaderCredentials{Name: "Authorization", Value: "Bearer " + token}
+}
+
+// Authorize implements Credentials
+func (c *HeaderCredentials) Authorize(req *http.Request) error {
+	req.Header.Set(c.Name, c.Value)
+	return nil
+}
+
+// BasicCredentials use the basic http authentication
+type BasicCredentials struct {
+	User     string
+	Password string
+}
+
+// Authorize implements Credentials
+func (c *BasicCredentials) Authorize(req *http.Request) error {
+	req.SetBasicAuth(c.User, c.Password)
+	return nil
+}
+
+// TokenCredentials send a bearer token obtained from the source, the token is requested again
+// with refresh set when the server rejects it
+type TokenCredentials struct {
+	source func(ctx context.Context, refresh bool) (string, error)
+
+	mu    sync.Mutex
+	token string
+}
+
+// NewTokenCredentials returns credentials using tokens of the source
+func NewTokenCredentials(source func(ctx context.Context, refresh bool) (string, error)) *TokenCredentials {
+	return &TokenCredentials{source: source}
+}
+
+// Authorize implements Credentials
+func (c *TokenCredentials) Authorize(req *http.Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token == "" {
+		token, err := c.source(req.Context(), false)
+		if err != nil {
+			return err
+		}
+		c.token = token
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	return nil
+}
+
+// Refresh implements CredentialsRefresher
+func (c *TokenCredentials) Refresh(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	token, err := c.source(ctx, true)
+	if err != nil {
+		return err
+	}
+	c.token = token
+	return nil
+}
+
+// NetrcCredentials use the basic authentication with the login and password of the host from a .netrc file
+type NetrcCredentials struct {
+	entries map[string]netrcEntry
+}
+
+type netrcEntry struct {
+	login    string
+	password string
+}
+
+// DefaultNetrcPath returns $NETRC or ~/.netrc
+func DefaultNetrcPath() string {
+	if p := os.Getenv("NETRC"); p != "" {
+		return p
+	}
+	return filepath.Join(UserHomeDir(), ".netrc")
+}
+
+// NewNetrcCredentials reads the .netrc file
+func NewNetrcCredentials(path string) (*NetrcCredentials, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries, err := parseNetrc(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NetrcCredentials{entries: entries}, nil
+}
+
+// Authorize implements Credentials, requests to hosts without an entry or a default are left as is
+func (c *NetrcCredentials) Authorize(req *http.Request) error {
+	e, ok := c.entries[req.URL.Hostname()]
+	if !ok {
+		e, ok = c.entries[""]
+	}
+	if ok && e.login != "" {
+		req.SetBasicAuth(e.login, e.password)
+	}
+	return nil
+}
+
+// parseNetrc returns entries by machine name, the default entry has an empty name
+func parseNetrc(r io.Reader) (map[string]netrcEntry, error) {
+	var (
+		entries   = make(map[string]netrcEntry)
+		machine   string
+		inMachine bool
+		inMacro   bool
+		entry     netrcEntry
+	)
+	flush := func() {
+		// the first entry of a machine wins
+		if _, ok := entries[machine]; inMachine && !ok {
+			entries[machine] = entry
+		}
+		inMachine, entry = false, netrcEntry{}
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// macro definitions end with an empty line
+		if inMacro {
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+
+		fields := strings.Fields(line)
+	Line:
+		for i := 0; i < len(fields); i++ {
+			next := func() string {
+				if i+1 < len(fields) {
+					i++
+					return fields[i]
+				}
+				return ""
+			}
+
+			switch fields[i] {
+			case "machine":
+				flush()
+				machine, inMachine = next(), true
+			case "default":
+				flush()
+				machine, inMachine = "", true
+			case "login":
+				entry.login = next()
+			case "password":
+				entry.password = next()
+			case "account":
+				next()
+			case "macdef":
+				flush()
+				inMacro = true
+				break Line
+			default:
+				if strings.HasPrefix(fields[i], "#") {
+					break Line
+				}
+			}
+		}
+	}
+	flush()
+
+	return entries, scanner.Err()
+}
+
+// authorize applies the credentials to the request and to redirects to the same host,
+// they are dropped when https is downgraded to http
+func (d *Downloader) authorize(req *http.Request, client *http.Client) (*http.Client, error) {
+	if d.Credentials == nil {
+		return client, nil
+	}
+
+	// credentials are collected separately to know which headers to drop on redirects to other hosts
+	creds := (&http.Request{URL: req.URL, Header: http.Header{}}).WithContext(req.Context())
+	if err := d.Credentials.Authorize(creds); err != nil {
+		return nil, err
+	}
+	for name, values := range creds.Header {
+		req.Header[name] = values
+	}
+
+	authorized := *client
+	checkRedirect := client.CheckRedirect
+	authorized.CheckRedirect = func(next *http.Request, via []*http.Request) error {
+		downgrade := via[0].URL.Scheme == "https" && next.URL.Scheme != "https"
+		if next.URL.Host != via[0].URL.Host || downgrade {
+			for name := range creds.Header {
+				next.Header.Del(name)
+			}
+		}
+
+		if checkRedirect != nil {
+			return checkRedirect(next, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+
+	return &authorized, nil
+}
@@ -0,0 +1,143 @@
+package help
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseNetrc(t *testing.T) {
+	const netrc = `# private builds
+machine images.example.com login builder password s3cret
+macdef init
+cd /pub
+machine ignored.example.com login macro
+
+machine other.example.com
+	login other
+	password pass account acc
+default login anonymous password guest
+`
+	entries, err := parseNetrc(strings.NewReader(netrc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		machine string
+		want    netrcEntry
+	}{
+		{"images.example.com", netrcEntry{"builder", "s3cret"}},
+		{"other.example.com", netrcEntry{"other", "pass"}},
+		{"", netrcEntry{"anonymous", "guest"}},
+	} {
+		if got := entries[tt.machine]; got != tt.want {
+			t.Errorf("%q. parseNetrc() = %v, want %v", tt.machine, got, tt.want)
+		}
+	}
+	if _, ok := entries["ignored.example.com"]; ok {
+		t.Error("parseNetrc() parsed the macro body")
+	}
+}
+
+func TestDownloaderCredentials(t *testing.T) {
+	content := bytes.Repeat([]byte("private"), 1000)
+
+	var leaked string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaked = r.Header.Get("Authorization")
+		http.ServeContent(w, r, "other.img", time.Time{}, bytes.NewReader(content))
+	}))
+	defer other.Close()
+
+	token := "old"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/latest":
+			http.Redirect(w, r, "/build.img", http.StatusFound)
+		case "/external":
+			http.Redirect(w, r, other.URL+"/other.img", http.StatusFound)
+		default:
+			http.ServeContent(w, r, "build.img", time.Time{}, bytes.NewReader(content))
+		}
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var refreshed int
+	d := NewDownloader()
+	d.Quiet = true
+	d.Credentials = NewTokenCredentials(func(ctx context.Context, refresh bool) (string, error) {
+		if refresh {
+			refreshed++
+			return "new", nil
+		}
+		return "old", nil
+	})
+
+	// the token expires, it's refreshed on 401 and kept on the redirect to the same host
+	token = "new"
+	d.FileName = "build.img"
+	if _, err := d.Download(context.Background(), srv.URL+"/latest", dir); err != nil {
+		t.Fatal(err)
+	}
+	if refreshed != 1 {
+		t.Errorf("Token refreshed %d times, want 1", refreshed)
+	}
+
+	d.FileName = "other.img"
+	if _, err := d.Download(context.Background(), srv.URL+"/external", dir); err != nil {
+		t.Fatal(err)
+	}
+	if leaked != "" {
+		t.Errorf("Credentials forwarded to another host: %q", leaked)
+	}
+}
+
+func TestAuthorizeRedirect(t *testing.T) {
+	d := NewDownloader()
+	d.Credentials = NewTokenCredentials(func(ctx context.Context, refresh bool) (string, error) {
+		return "secret", nil
+	})
+
+	tests := []struct {
+		from string
+		to   string
+		want bool
+	}{
+		{"https://builds.example.com/latest", "https://builds.example.com/build.img", true},
+		{"http://builds.example.com/latest", "https://builds.example.com/build.img", true},
+		{"https://builds.example.com/latest", "http://builds.example.com/build.img", false},
+		{"https://builds.example.com/latest", "https://cdn.example.com/build.img", false},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", tt.from, nil)
+		client, err := d.authorize(req, &http.Client{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		next, _ := http.NewRequest("GET", tt.to, nil)
+		next.Header = req.Header.Clone()
+		if err := client.CheckRedirect(next, []*http.Request{req}); err != nil {
+			t.Fatal(err)
+		}
+		if got := next.Header.Get("Authorization") != ""; got != tt.want {
+			t.Errorf("%q. CheckRedirect() to %s kept credentials = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
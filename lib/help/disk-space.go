@@ -0,0 +1,247 @@
+package help
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+	pb "gopkg.in/cheggaaa/pb.v1"
+)
+
+// ErrInsufficientSpace is matched by *SpaceError with errors.Is
+var ErrInsufficientSpace = errors.New("insufficient disk space")
+
+// ErrSizeUnknown is returned by UncompressedSize for formats without size metadata
+var ErrSizeUnknown = errors.New("uncompressed size is unknown")
+
+// SpaceError is returned by preflight checks when the destination filesystem is too small
+type SpaceError struct {
+	Path      string
+	Required  int64
+	Available int64
+}
+
+func (e *SpaceError) Error() string {
+	return fmt.Sprintf("%s in %s: %s required, %s available", ErrInsufficientSpace.Error(), e.Path,
+		pb.Format(e.Required).To(pb.U_BYTES), pb.Format(e.Available).To(pb.U_BYTES))
+}
+
+func (e *SpaceError) Unwrap() error {
+	return ErrInsufficientSpace
+}
+
+// FreeSpace returns the bytes available to the user on the filesystem of the path,
+// the nearest existing parent is used when the path doesn't exist yet
+func FreeSpace(path string) (int64, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return 0, err
+	}
+	for !Exists(path) && filepath.Dir(path) != path {
+		path = filepath.Dir(path)
+	}
+	return freeSpace(path)
+}
+
+// CheckSpace returns a *SpaceError if the required bytes don't fit on the filesystem of the path.
+// Filesystems which can't be queried pass the check
+func CheckSpace(path string, required int64) error {
+	if required <= 0 {
+		return nil
+	}
+	available, err := FreeSpace(path)
+	if err != nil {
+		log.Debug("Can't get free space of ", path, ": ", err.Error())
+		return nil
+	}
+	if required > available {
+		return &SpaceError{Path: path, Required: required, Available: available}
+	}
+	return nil
+}
+
+// CheckDownloadSpace checks that the remote file fits into the destination folder
+func (d *Downloader) CheckDownloadSpace(ctx context.Context, rawurl, destination string) error {
+	info, err := d.RemoteInfo(ctx, rawurl)
+	if err != nil {
+		return err
+	}
+	return CheckSpace(destination, info.Length)
+}
+
+// CheckExtractSpace checks that the uncompressed content of the file fits into the destination,
+// files of formats without size metadata pass the check
+func CheckExtractSpace(file, destination string) error {
+	size, err := UncompressedSize(file)
+	if errors.Is(err, ErrSizeUnknown) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return CheckSpace(destination, size)
+}
+
+// CheckCopySpace checks that the file or the directory fits into the destination
+func CheckCopySpace(src, destination string) error {
+	size, err := DirSize(src)
+	if err != nil {
+		return err
+	}
+	return CheckSpace(destination, size)
+}
+
+// DirSize returns the total size of regular files under the path
+func DirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// UncompressedSize returns the size of the content of zip and xz files read from their
+// metadata, the size of uncompressed files, or ErrSizeUnknown for other formats
+func UncompressedSize(file string) (int64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	header := make([]byte, compressionMagicSize)
+	n, _ := io.ReadFull(f, header)
+	switch DetectCompression(header[:n]) {
+	case CompressionNone:
+		info, err := f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	case CompressionZip:
+		return zipSize(file)
+	case CompressionXz:
+		return xzSize(f)
+	}
+	return 0, ErrSizeUnknown
+}
+
+func zipSize(file string) (int64, error) {
+	r, err := zip.OpenReader(file)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	var size int64
+	for _, f := range r.File {
+		size += int64(f.UncompressedSize64)
+	}
+	return size, nil
+}
+
+var errXzIndex = errors.New("invalid xz index")
+
+// xzSize sums uncompressed sizes of the blocks listed in the indexes of all the streams of the file
+func xzSize(f *os.File) (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	end := info.Size()
+	for end > 0 {
+		if end < 24 {
+			return 0, errXzIndex
+		}
+		// streams may be followed by zero padding in 4 byte words
+		word := make([]byte, 4)
+		if _, err := f.ReadAt(word, end-4); err != nil {
+			return 0, err
+		}
+		if binary.LittleEndian.Uint32(word) == 0 {
+			end -= 4
+			continue
+		}
+
+		footer := make([]byte, 12)
+		if _, err := f.ReadAt(footer, end-12); err != nil {
+			return 0, err
+		}
+		if string(footer[10:]) != "YZ" {
+			return 0, errXzIndex
+		}
+		indexSize := (int64(binary.LittleEndian.Uint32(footer[4:8])) + 1) * 4
+		indexStart := end - 12 - indexSize
+		if indexStart < 12 {
+			return 0, errXzIndex
+		}
+
+		index := make([]byte, indexSize)
+		if _, err := f.ReadAt(index, indexStart); err != nil {
+			return 0, err
+		}
+		uncompressed, blocks, err := parseXzIndex(index)
+		if err != nil {
+			return 0, err
+		}
+		size += uncompressed
+		// the stream header precedes the blocks
+		end = indexStart - blocks - 12
+		if end < 0 {
+			return 0, errXzIndex
+		}
+	}
+	return size, nil
+}
+
+// parseXzIndex returns the uncompressed size and the length of the blocks of a stream
+func parseXzIndex(index []byte) (uncompressed, blocks int64, err error) {
+	if len(index) == 0 || index[0] != 0 {
+		return 0, 0, errXzIndex
+	}
+	pos := 1
+	next := func() (int64, error) {
+		var v uint64
+		for i := 0; i < 9 && pos < len(index); i++ {
+			b := index[pos]
+			pos++
+			v |= uint64(b&0x7f) << (7 * uint(i))
+			if b&0x80 == 0 {
+				return int64(v), nil
+			}
+		}
+		return 0, errXzIndex
+	}
+
+	records, err := next()
+	if err != nil {
+		return 0, 0, err
+	}
+	for i := int64(0); i < records; i++ {
+		unpadded, err := next()
+		if err != nil {
+			return 0, 0, err
+		}
+		size, err := next()
+		if err != nil {
+			return 0, 0, err
+		}
+		blocks += (unpadded + 3) &^ 3
+		uncompressed += size
+	}
+	return uncompressed, blocks, nil
+}
@@ -0,0 +1,115 @@
+package help
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ulikunitz/xz"
+)
+
+func TestCheckSpace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "space")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	free, err := FreeSpace(filepath.Join(dir, "not", "created"))
+	if err != nil || free <= 0 {
+		t.Fatalf("FreeSpace() = %d, %v", free, err)
+	}
+	if err := CheckSpace(dir, 1024); err != nil {
+		t.Errorf("CheckSpace(1K) error = %v", err)
+	}
+
+	err = CheckSpace(dir, free+1<<40)
+	var spaceErr *SpaceError
+	if !errors.Is(err, ErrInsufficientSpace) || !errors.As(err, &spaceErr) || spaceErr.Available != free {
+		t.Errorf("CheckSpace() error = %v, want ErrInsufficientSpace", err)
+	}
+}
+
+func TestUncompressedSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "space")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := bytes.Repeat([]byte("edison image "), 100000)
+
+	var xzBuf bytes.Buffer
+	// two streams with padding in between
+	for i := 0; i < 2; i++ {
+		w, _ := xz.NewWriter(&xzBuf)
+		w.Write(content)
+		w.Close()
+		xzBuf.Write(make([]byte, 8))
+	}
+	xzFile := filepath.Join(dir, "image.img.xz")
+	ioutil.WriteFile(xzFile, xzBuf.Bytes(), 0644)
+
+	var zipBuf bytes.Buffer
+	zw := zip.NewWriter(&zipBuf)
+	for _, name := range []string{"a.img", "b.img"} {
+		f, _ := zw.Create(name)
+		f.Write(content)
+	}
+	zw.Close()
+	zipFile := filepath.Join(dir, "image.zip")
+	ioutil.WriteFile(zipFile, zipBuf.Bytes(), 0644)
+
+	rawFile := filepath.Join(dir, "image.img")
+	ioutil.WriteFile(rawFile, content, 0644)
+
+	tests := []struct {
+		file string
+		want int64
+	}{
+		{xzFile, 2 * int64(len(content))},
+		{zipFile, 2 * int64(len(content))},
+		{rawFile, int64(len(content))},
+	}
+	for _, tt := range tests {
+		if got, err := UncompressedSize(tt.file); err != nil || got != tt.want {
+			t.Errorf("%q. UncompressedSize() = %d, %v, want %d", filepath.Base(tt.file), got, err, tt.want)
+		}
+	}
+
+	if size, err := DirSize(dir); err != nil || size != int64(xzBuf.Len()+zipBuf.Len()+len(content)) {
+		t.Errorf("DirSize() = %d, %v", size, err)
+	}
+}
+
+func TestDownloadInsufficientSpace(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1152921504606846976")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "space")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := NewDownloader()
+	d.Quiet = true
+	d.Retries = 3
+	_, err = d.Download(context.Background(), srv.URL+"/huge.img", dir)
+	if !errors.Is(err, ErrInsufficientSpace) {
+		t.Fatalf("Download() error = %v, want ErrInsufficientSpace", err)
+	}
+	if Exists(filepath.Join(dir, "huge.img"+partSuffix)) {
+		t.Error("Download() created the part file")
+	}
+}
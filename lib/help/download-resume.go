@@ -0,0 +1,130 @@
+package help
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Partial downloads are written to the file with partSuffix, its resume state is stored next to it
+const (
+	partSuffix        = ".part"
+	resumeStateSuffix = ".json"
+)
+
+// resumeState identifies the remote file a partial download belongs to
+type resumeState struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Length       int64  `json:"length"`
+}
+
+func newResumeState(rawurl string, resp *http.Response) *resumeState {
+	return &resumeState{
+		URL:          redactURL(rawurl),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Length:       resp.ContentLength,
+	}
+}
+
+// loadResumeState returns the state of the partial file if it belongs to the url and can be validated
+func loadResumeState(part, rawurl string) *resumeState {
+	s := readResumeState(part)
+	if s == nil || s.URL != redactURL(rawurl) || s.validator() == "" {
+		return nil
+	}
+
+	return s
+}
+
+// readResumeState returns the state of the partial file whatever url it belongs to
+func readResumeState(part string) *resumeState {
+	b, err := ioutil.ReadFile(part + resumeStateSuffix)
+	if err != nil {
+		return nil
+	}
+
+	s := &resumeState{}
+	if err := json.Unmarshal(b, s); err != nil {
+		log.Debug("Invalid resume state of ", part, ": ", err.Error())
+		return nil
+	}
+
+	return s
+}
+
+func (s *resumeState) save(part string) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(part+resumeStateSuffix, b, 0644)
+}
+
+// validator returns the If-Range value, weak ETags can't be used for ranges
+func (s *resumeState) validator() string {
+	if s.ETag != "" && !strings.HasPrefix(s.ETag, "W/") {
+		return s.ETag
+	}
+	return s.LastModified
+}
+
+func removeResumeState(part string) {
+	DeleteFile(part + resumeStateSuffix)
+}
+
+// getIfRange requests the rest of the file from the offset if it still matches the validator,
+// the server responds with the whole file otherwise
+func (d *Downloader) getIfRange(ctx context.Context, rawurl string, offset int64, validator string) (*http.Response, error) {
+	header := http.Header{}
+	header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	header.Set("If-Range", validator)
+
+	resp, err := d.request(ctx, http.MethodGet, rawurl, header)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp, nil
+	case http.StatusPartialContent:
+		if start, ok := contentRangeStart(resp.Header.Get("Content-Range")); ok && start == offset {
+			return resp, nil
+		}
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: unexpected Content-Range %q", redactURL(rawurl), resp.Header.Get("Content-Range"))
+	case http.StatusRequestedRangeNotSatisfiable:
+		resp.Body.Close()
+		// the partial file is complete, the rest is empty
+		if contentRangeTotal(resp.Header.Get("Content-Range")) == offset && (resp.Header.Get("ETag") == validator || resp.Header.Get("Last-Modified") == validator) {
+			resp.StatusCode, resp.ContentLength, resp.Body = http.StatusPartialContent, 0, http.NoBody
+			return resp, nil
+		}
+		// the partial file is longer than the remote one, start over
+		return d.get(ctx, rawurl, 0, -1)
+	}
+
+	resp.Body.Close()
+	return nil, newHTTPStatusError(resp)
+}
+
+// contentRangeStart parses the first byte position of the `bytes start-end/total` header
+func contentRangeStart(contentRange string) (int64, bool) {
+	contentRange = strings.TrimPrefix(contentRange, "bytes ")
+	i := strings.Index(contentRange, "-")
+	if i < 0 {
+		return 0, false
+	}
+
+	start, err := strconv.ParseInt(contentRange[:i], 10, 64)
+	return start, err == nil
+}
@@ -0,0 +1,181 @@
+package help
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// minSegmentSize is the smallest byte range worth a separate connection
+const minSegmentSize = 4 * 1024 * 1024
+
+// defaultSegmentRetries is the number of attempts of a segment, a dropped connection
+// shouldn't fail the whole download
+const defaultSegmentRetries = 3
+
+// ErrRemoteChanged is returned when the remote file changes while its segments are downloaded
+var ErrRemoteChanged = errors.New("remote file changed during the download")
+
+// segment is an inclusive byte range of a remote file
+type segment struct {
+	start, end int64
+}
+
+// splitSegments splits the length into n byte ranges of at least minSegmentSize bytes
+func splitSegments(length int64, n int) []segment {
+	if limit := length / minSegmentSize; int64(n) > limit {
+		n = int(limit)
+	}
+	if n < 1 {
+		n = 1
+	}
+
+	size := length / int64(n)
+	segments := make([]segment, n)
+	for i := range segments {
+		segments[i].start = int64(i) * size
+		segments[i].end = segments[i].start + size - 1
+	}
+	segments[n-1].end = length - 1
+
+	return segments
+}
+
+// segmented returns true if the response can be downloaded with concurrent ranged requests
+func (d *Downloader) segmented(resp *http.Response) bool {
+	return d.Segments > 1 &&
+		resp.StatusCode == http.StatusOK &&
+		resp.Header.Get("Accept-Ranges") == "bytes" &&
+		resp.ContentLength >= 2*minSegmentSize
+}
+
+// downloadSegmented downloads the url into the preallocated output with Segments concurrent ranged requests,
+// every segment is retried on its own according to the segment retry policy. The requests carry the validator
+// of the first response as If-Range, so segments of another version of the file fail with ErrRemoteChanged.
+// Progress receives the number of bytes written by any of the segments and may be called concurrently
+func (d *Downloader) downloadSegmented(ctx context.Context, rawurl, validator string, output *os.File, length int64, progress func(n int64)) error {
+	if err := output.Truncate(length); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	segments := splitSegments(length, d.Segments)
+	log.WithField("url", redactURL(rawurl)).Debug("Downloading in ", len(segments), " segments")
+
+	errs := make(chan error, len(segments))
+	for _, s := range segments {
+		go func(s segment) {
+			errs <- d.fetchSegment(ctx, rawurl, validator, length, output, s, progress)
+		}(s)
+	}
+
+	var err error
+	for range segments {
+		if e := <-errs; e != nil && err == nil {
+			// abort the rest of the segments
+			err = e
+			cancel()
+		}
+	}
+
+	return err
+}
+
+// segmentRetryPolicy returns the RetryPolicy or a backoff of SegmentRetries attempts
+func (d *Downloader) segmentRetryPolicy() RetryPolicy {
+	if d.RetryPolicy != nil {
+		return d.RetryPolicy
+	}
+	retries := d.SegmentRetries
+	if retries < 1 {
+		retries = defaultSegmentRetries
+	}
+	return NewBackoff(retries)
+}
+
+// fetchSegment downloads the byte range into the output at the same offset,
+// continues from the last written byte on retries
+func (d *Downloader) fetchSegment(ctx context.Context, rawurl, validator string, length int64, output io.WriterAt, s segment, progress func(n int64)) error {
+	policy := d.segmentRetryPolicy()
+	started := time.Now()
+	for attempt := 1; ; attempt++ {
+		n, err := d.copySegment(ctx, rawurl, validator, length, output, s, progress)
+		s.start += n
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		delay, retry := policy.Next(attempt, time.Since(started), err)
+		if !retry {
+			return err
+		}
+		log.WithField("url", redactURL(rawurl)).WithField("attempt", attempt).
+			Debug("Segment ", s.start, "-", s.end, " failed: ", err.Error())
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// copySegment writes the byte range of the file of the given length and validator into the output
+func (d *Downloader) copySegment(ctx context.Context, rawurl, validator string, length int64, output io.WriterAt, s segment, progress func(n int64)) (int64, error) {
+	header := http.Header{}
+	header.Set("Range", "bytes="+strconv.FormatInt(s.start, 10)+"-"+strconv.FormatInt(s.end, 10))
+	header.Set("If-Range", validator)
+
+	resp, err := d.request(ctx, http.MethodGet, rawurl, header)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	want := s.end - s.start + 1
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		contentRange := resp.Header.Get("Content-Range")
+		start, ok := contentRangeStart(contentRange)
+		if !ok || start != s.start || contentRangeTotal(contentRange) != length || (resp.ContentLength >= 0 && resp.ContentLength != want) {
+			return 0, fmt.Errorf("GET %s: %w: unexpected Content-Range %q", redactURL(rawurl), ErrRemoteChanged, contentRange)
+		}
+	case http.StatusOK:
+		// the validator doesn't match anymore, the whole new file is sent
+		return 0, fmt.Errorf("GET %s: %w", redactURL(rawurl), ErrRemoteChanged)
+	default:
+		return 0, newHTTPStatusError(resp)
+	}
+
+	prd := NewHttpProxyReader(io.LimitReader(d.limit(resp.Body), want), func(n int, _ error) {
+		progress(int64(n))
+	})
+	n, err := io.Copy(&offsetWriter{output, s.start}, prd)
+	if err == nil && n != want {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return n, err
+}
+
+// offsetWriter writes sequentially into the io.WriterAt starting from the offset
+type offsetWriter struct {
+	io.WriterAt
+	offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (n int, err error) {
+	n, err = w.WriteAt(p, w.offset)
+	w.offset += int64(n)
+
+	return
+}
@@ -0,0 +1,397 @@
+package help
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Compression is a compression format of a stream
+type Compression string
+
+// Compression formats detected by DetectCompression
+const (
+	CompressionNone  Compression = ""
+	CompressionGzip  Compression = "gzip"
+	CompressionXz    Compression = "xz"
+	CompressionBzip2 Compression = "bzip2"
+	CompressionZstd  Compression = "zstd"
+	CompressionZip   Compression = "zip"
+)
+
+var compressionMagic = []struct {
+	compression Compression
+	magic       []byte
+}{
+	{CompressionGzip, []byte{0x1f, 0x8b}},
+	{CompressionXz, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{CompressionBzip2, []byte("BZh")},
+	{CompressionZstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{CompressionZip, []byte("PK\x03\x04")},
+}
+
+// compressionMagicSize is enough bytes to detect any supported format
+const compressionMagicSize = 6
+
+// Errors of streaming downloads
+var (
+	ErrStreamSignature  = errors.New("signatures can't be verified while streaming")
+	ErrZipNotStreamable = errors.New("zip archive can't be streamed: the server doesn't support ranges")
+	ErrZipDigest        = errors.New("digest of a zip archive can't be verified while streaming its entry")
+)
+
+// DetectCompression returns the compression format by the magic bytes at the start of the data
+func DetectCompression(header []byte) Compression {
+	for _, m := range compressionMagic {
+		if bytes.HasPrefix(header, m.magic) {
+			return m.compression
+		}
+	}
+	return CompressionNone
+}
+
+// NewDecompressor returns a reader decompressing the format, the reader must be closed
+func NewDecompressor(compression Compression, r io.Reader) (io.ReadCloser, error) {
+	switch compression {
+	case CompressionNone:
+		return ioutil.NopCloser(r), nil
+	case CompressionGzip:
+		return gzip.NewReader(r)
+	case CompressionXz:
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(xr), nil
+	case CompressionBzip2:
+		return ioutil.NopCloser(bzip2.NewReader(r)), nil
+	case CompressionZstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}
+
+	return nil, fmt.Errorf("unsupported compression %q", compression)
+}
+
+// StreamResult describes a streamed download
+type StreamResult struct {
+	Compression Compression
+	// Entry is the name of the file streamed out of a zip archive
+	Entry string
+	// Compressed is the number of bytes received, Decompressed is the number of bytes written
+	Compressed   int64
+	Decompressed int64
+	// Digest is the hash of the received data, it isn't computed for zip archives
+	Digest Digest
+	// DecompressedDigest is the sha256 of the written data
+	DecompressedDigest Digest
+}
+
+// DownloadStream downloads the url decompressing it on the fly into the writer, no intermediate
+// files are created. The format is detected by magic bytes, zip archives are streamed when the server
+// supports ranges and the archive has a single file or a single .img file. The expected digest
+// is checked against the received data once it's written, so the writer should discard the output
+// on error. Streams are not retried as the written data can't be taken back
+func (d *Downloader) DownloadStream(ctx context.Context, rawurl string, w io.Writer) (*StreamResult, error) {
+	if d.Verifier != nil {
+		return nil, ErrStreamSignature
+	}
+
+	fileName := d.FileName
+	if fileName == "" {
+		fileName = FileNameFromURL(rawurl)
+	}
+	digest, err := d.expectedDigest(ctx, fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	t := d.track(rawurl, fileName)
+	result, err := d.stream(ctx, rawurl, w, digest, t)
+	if err != nil {
+		t.fail(err)
+		return nil, err
+	}
+
+	t.finish(false)
+	return result, nil
+}
+
+func (d *Downloader) stream(ctx context.Context, rawurl string, w io.Writer, digest Digest, t *progressTracker) (*StreamResult, error) {
+	body, length, finalURL, err := d.open(ctx, rawurl)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	br := bufio.NewReader(d.limit(body))
+	header, _ := br.Peek(compressionMagicSize)
+	result := &StreamResult{Compression: DetectCompression(header)}
+
+	if result.Compression == CompressionZip {
+		if !digest.IsZero() {
+			return nil, ErrZipDigest
+		}
+		body.Close()
+		if err := d.streamZip(ctx, finalURL, w, result, t); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	if digest.IsZero() {
+		digest.Algorithm = SHA256
+	}
+	h, err := digest.newHash()
+	if err != nil {
+		return nil, err
+	}
+
+	t.start(0, length)
+	compressed := io.TeeReader(br, h)
+	compressed = NewHttpProxyReader(compressed, func(n int, _ error) {
+		result.Compressed += int64(n)
+		t.add(int64(n))
+	})
+
+	decompressor, err := NewDecompressor(result.Compression, compressed)
+	if err != nil {
+		return nil, err
+	}
+	defer decompressor.Close()
+
+	decompressedHash := sha256.New()
+	if err := copyDecompressed(w, decompressor, decompressedHash, result, t); err != nil {
+		return nil, err
+	}
+	// data after the end of the compressed stream is hashed too
+	if _, err := io.Copy(ioutil.Discard, compressed); err != nil {
+		return nil, err
+	}
+
+	if length > 0 && result.Compressed != length {
+		return nil, fmt.Errorf("%s: received %d bytes out of %d: %w", redactURL(rawurl), result.Compressed, length, io.ErrUnexpectedEOF)
+	}
+
+	result.Digest = Digest{Algorithm: digest.Algorithm, Sum: h.Sum(nil)}
+	result.DecompressedDigest = Digest{Algorithm: SHA256, Sum: decompressedHash.Sum(nil)}
+	if !digest.IsZero() && !result.Digest.Equal(digest) {
+		return nil, &ChecksumError{File: redactURL(rawurl), Expected: digest, Actual: result.Digest}
+	}
+
+	return result, nil
+}
+
+// copyDecompressed writes the data into the writer and the hash counting written bytes
+func copyDecompressed(w io.Writer, r io.Reader, h hash.Hash, result *StreamResult, t *progressTracker) error {
+	n, err := io.Copy(io.MultiWriter(w, h, writerFunc(func(p []byte) (int, error) {
+		t.decompress(int64(len(p)))
+		return len(p), nil
+	})), r)
+	result.Decompressed += n
+	return err
+}
+
+// writerFunc is a function used as an io.Writer
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+// open returns the content of the url, its length or -1 if unknown and the url after redirects
+func (d *Downloader) open(ctx context.Context, rawurl string) (io.ReadCloser, int64, string, error) {
+	if isHTTP(rawurl) {
+		resp, err := d.get(ctx, rawurl, 0, -1)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		return resp.Body, resp.ContentLength, resp.Request.URL.String(), nil
+	}
+
+	src, err := d.Source(rawurl)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	info, err := src.Stat(ctx)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	body, err := src.Open(ctx)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	return body, info.Length, rawurl, nil
+}
+
+// streamZip reads the central directory with ranged reads and streams the data of the entry
+func (d *Downloader) streamZip(ctx context.Context, rawurl string, w io.Writer, result *StreamResult, t *progressTracker) error {
+	src, err := d.Source(rawurl)
+	if err != nil {
+		return err
+	}
+	info, err := src.Stat(ctx)
+	if err != nil {
+		return err
+	}
+	rs, ok := src.(RangeSource)
+	if !ok || !info.AcceptRanges || info.Length <= 0 {
+		return ErrZipNotStreamable
+	}
+
+	ra := &sourceReaderAt{ctx: ctx, src: rs}
+	defer ra.Close()
+	zr, err := zip.NewReader(ra, info.Length)
+	if err != nil {
+		return err
+	}
+	f, err := zipStreamEntry(zr)
+	if err != nil {
+		return err
+	}
+	result.Entry = f.Name
+
+	offset, err := f.DataOffset()
+	if err != nil {
+		return err
+	}
+	// the data is read with a range of its own
+	ra.Close()
+
+	t.start(0, int64(f.CompressedSize64))
+	var body io.Reader = bytes.NewReader(nil)
+	if f.CompressedSize64 > 0 {
+		rc, err := rs.OpenRange(ctx, offset, int64(f.CompressedSize64))
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		body = io.LimitReader(d.limit(rc), int64(f.CompressedSize64))
+	}
+	body = NewHttpProxyReader(body, func(n int, _ error) {
+		result.Compressed += int64(n)
+		t.add(int64(n))
+	})
+
+	var decompressor io.ReadCloser
+	switch f.Method {
+	case zip.Store:
+		decompressor = ioutil.NopCloser(body)
+	case zip.Deflate:
+		decompressor = flate.NewReader(body)
+	default:
+		return zip.ErrAlgorithm
+	}
+	defer decompressor.Close()
+
+	crc := crc32.NewIEEE()
+	decompressedHash := sha256.New()
+	if err := copyDecompressed(io.MultiWriter(w, crc), decompressor, decompressedHash, result, t); err != nil {
+		return err
+	}
+	if result.Compressed != int64(f.CompressedSize64) || crc.Sum32() != f.CRC32 {
+		return zip.ErrChecksum
+	}
+
+	result.DecompressedDigest = Digest{Algorithm: SHA256, Sum: decompressedHash.Sum(nil)}
+	return nil
+}
+
+// zipStreamEntry returns the only file of the archive or its only .img file
+func zipStreamEntry(zr *zip.Reader) (*zip.File, error) {
+	var files, images []*zip.File
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		files = append(files, f)
+		if strings.EqualFold(filepath.Ext(f.Name), ".img") {
+			images = append(images, f)
+		}
+	}
+
+	switch {
+	case len(files) == 1:
+		return files[0], nil
+	case len(images) == 1:
+		return images[0], nil
+	}
+
+	return nil, fmt.Errorf("zip archive has %d files and %d images, can't choose one to stream", len(files), len(images))
+}
+
+// sourceReaderAt reads a file with ranged reads of the source, the open range is reused by
+// reads continuing where the previous one stopped
+type sourceReaderAt struct {
+	ctx context.Context
+	src RangeSource
+
+	mu  sync.Mutex
+	rc  io.ReadCloser
+	pos int64
+}
+
+func (r *sourceReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.rc == nil || r.pos != off {
+		r.close()
+		rc, err := r.src.OpenRange(r.ctx, off, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.rc, r.pos = rc, off
+	}
+
+	n, err := io.ReadFull(r.rc, p)
+	r.pos += int64(n)
+	if err != nil {
+		r.close()
+	}
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Close closes the open range
+func (r *sourceReaderAt) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.close()
+}
+
+func (r *sourceReaderAt) close() error {
+	if r.rc == nil {
+		return nil
+	}
+	err := r.rc.Close()
+	r.rc = nil
+	return err
+}
@@ -0,0 +1,169 @@
+package help
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+func TestDownloadStream(t *testing.T) {
+	image := bytes.Repeat([]byte("raspberry pi image "), 10000)
+	imageSum := sha256.Sum256(image)
+
+	compress := func(newWriter func(w io.Writer) (io.WriteCloser, error)) []byte {
+		var buf bytes.Buffer
+		w, err := newWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(image)
+		w.Close()
+		return buf.Bytes()
+	}
+	zipped := compress(func(w io.Writer) (io.WriteCloser, error) {
+		zw := zip.NewWriter(w)
+		if _, err := zw.Create("boot/"); err != nil {
+			return nil, err
+		}
+		fw, err := zw.Create("raspbian.img")
+		return &zipEntryWriter{fw, zw}, err
+	})
+
+	for _, tt := range []struct {
+		name        string
+		data        []byte
+		compression Compression
+	}{
+		{"raw.img", image, CompressionNone},
+		{"image.img.gz", compress(func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil }), CompressionGzip},
+		{"image.img.xz", compress(func(w io.Writer) (io.WriteCloser, error) { return xz.NewWriter(w) }), CompressionXz},
+		{"image.img.zst", compress(func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) }), CompressionZstd},
+		{"image.zip", zipped, CompressionZip},
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, tt.name, time.Time{}, bytes.NewReader(tt.data))
+		}))
+
+		var lastEvent ProgressEvent
+		d := NewDownloader()
+		d.Progress = ProgressFunc(func(e ProgressEvent) {
+			lastEvent = e
+		})
+		var out bytes.Buffer
+		result, err := d.DownloadStream(context.Background(), srv.URL+"/"+tt.name, &out)
+		srv.Close()
+		if err != nil {
+			t.Errorf("%q. DownloadStream() error = %v", tt.name, err)
+			continue
+		}
+
+		if result.Compression != tt.compression {
+			t.Errorf("%q. DownloadStream() compression = %q, want %q", tt.name, result.Compression, tt.compression)
+		}
+		if !bytes.Equal(out.Bytes(), image) {
+			t.Errorf("%q. DownloadStream() wrote different data", tt.name)
+		}
+		if result.Decompressed != int64(len(image)) || !bytes.Equal(result.DecompressedDigest.Sum, imageSum[:]) {
+			t.Errorf("%q. DownloadStream() decompressed %d bytes with digest %s", tt.name, result.Decompressed, result.DecompressedDigest)
+		}
+		if tt.compression != CompressionZip && result.Compressed != int64(len(tt.data)) {
+			t.Errorf("%q. DownloadStream() compressed = %d, want %d", tt.name, result.Compressed, len(tt.data))
+		}
+		if lastEvent.Type != ProgressFinished || lastEvent.Decompressed != int64(len(image)) {
+			t.Errorf("%q. Last event = %+v, want finish with decompressed bytes", tt.name, lastEvent)
+		}
+	}
+}
+
+func TestDownloadStreamDigest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("tampered"))
+	}))
+	defer srv.Close()
+
+	sum := sha256.Sum256([]byte("original"))
+	d := NewDownloader()
+	d.Quiet = true
+	d.Digest = Digest{Algorithm: SHA256, Sum: sum[:]}
+	_, err := d.DownloadStream(context.Background(), srv.URL+"/image.img", ioutil.Discard)
+	if _, ok := err.(*ChecksumError); !ok {
+		t.Errorf("DownloadStream() error = %v, want *ChecksumError", err)
+	}
+}
+
+// zipEntryWriter closes the archive along with the entry
+type zipEntryWriter struct {
+	io.Writer
+	zw *zip.Writer
+}
+
+func (w *zipEntryWriter) Close() error {
+	return w.zw.Close()
+}
+
+// countingSource counts the ranges opened on the source
+type countingSource struct {
+	RangeSource
+	opened int
+}
+
+func (s *countingSource) OpenRange(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	s.opened++
+	return s.RangeSource.OpenRange(ctx, offset, length)
+}
+
+func TestSourceReaderAt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	file := filepath.Join(dir, "image.zip")
+	ioutil.WriteFile(file, content, 0644)
+	src := &countingSource{RangeSource: &fileSource{path: file}}
+	ra := &sourceReaderAt{ctx: context.Background(), src: src}
+	defer ra.Close()
+
+	// sequential reads share the open range, a jump opens another one
+	p := make([]byte, 10)
+	for off := int64(100); off < 200; off += 10 {
+		if n, err := ra.ReadAt(p, off); n != 10 || err != nil || !bytes.Equal(p, content[off:off+10]) {
+			t.Fatalf("ReadAt(%d) = %d, %v", off, n, err)
+		}
+	}
+	if _, err := ra.ReadAt(p, 0); err != nil {
+		t.Fatal(err)
+	}
+	if src.opened != 2 {
+		t.Errorf("ReadAt() opened %d ranges, want 2", src.opened)
+	}
+	if n, err := ra.ReadAt(p, 995); n != 5 || err != io.EOF {
+		t.Errorf("ReadAt() at the end = %d, %v, want 5, EOF", n, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rc, err := src.OpenRange(ctx, 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if _, err := rc.Read(p); err != context.Canceled {
+		t.Errorf("Read() of a canceled file = %v, want context.Canceled", err)
+	}
+}
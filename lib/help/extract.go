@@ -0,0 +1,516 @@
+package help
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Archive formats detected by Extract
+const (
+	ArchiveTar  = "tar"
+	ArchiveZip  = "zip"
+	ArchiveFile = "file"
+)
+
+// ErrUnknownArchive is returned by Extract for files which are neither archives nor compressed
+var ErrUnknownArchive = errors.New("unknown archive format")
+
+// ErrUnsupportedArchive is returned for 7z archives which can't be read without external tools
+var ErrUnsupportedArchive = errors.New("unsupported archive format")
+
+var sevenZipMagic = []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}
+
+// defaultImageSuffixes are names of disk images reported by Extract
+var defaultImageSuffixes = []string{".img", ".iso"}
+
+// ExtractOptions configures Extract, nil options use the defaults
+type ExtractOptions struct {
+	// ImageSuffixes are suffixes of disk images reported in the result, .img and .iso by default
+	ImageSuffixes []string
+	// Sanitize extracts entries with ../ or absolute names under the destination and skips
+	// symlinks pointing outside of it, instead of failing
+	Sanitize bool
+	// MaxSize, MaxEntries and MaxRatio limit the total extracted size, the number of entries and
+	// the ratio of the extracted size to the archive size. Zero uses the defaults, negative disables the limit
+	MaxSize    int64
+	MaxEntries int
+	MaxRatio   float64
+	// StripComponents removes leading folders from the names, after ./ is removed.
+	// Entries with fewer folders are skipped
+	StripComponents int
+	// Patterns and Exclude select the entries by their stripped names, see MatchArchiveName.
+	// All entries are extracted if Patterns is empty
+	Patterns []string
+	Exclude  []string
+	// PreserveOwner sets the uid and gid of the entries, which usually needs root
+	PreserveOwner bool
+	Overwrite     Overwrite
+	// Callback is called before an entry is written to the path, ErrSkipEntry skips it
+	// and other errors stop the extraction
+	Callback func(e *ArchiveEntry, path string) error
+}
+
+// Overwrite is the policy for files existing in the destination
+type Overwrite int
+
+// Overwrite policies of Extract
+const (
+	// OverwriteAlways replaces existing files like tar does
+	OverwriteAlways Overwrite = iota
+	// OverwriteNever keeps existing files
+	OverwriteNever
+	// OverwriteNewer replaces files older than the entry
+	OverwriteNewer
+	// OverwriteError fails with os.ErrExist
+	OverwriteError
+)
+
+// ErrSkipEntry is returned by the Callback of ExtractOptions to skip the entry
+var ErrSkipEntry = errors.New("skip this entry")
+
+// ExtractResult lists the extracted files
+type ExtractResult struct {
+	// Format is one of ArchiveTar, ArchiveZip or ArchiveFile for a single compressed file
+	Format      string
+	Compression Compression
+	// Files are paths of the written regular files
+	Files []string
+	// Images are the disk images among the Files
+	Images []string
+}
+
+// Extract extracts tar archives compressed with gzip, bzip2, xz or zstd or uncompressed, zip archives,
+// and single compressed files such as .img.xz or .img.gz into the dst folder. The format is detected
+// by magic bytes, external tools are not used
+func Extract(ctx context.Context, src, dst string, opts *ExtractOptions) (*ExtractResult, error) {
+	if opts == nil {
+		opts = &ExtractOptions{}
+	}
+
+	f, _, err := openArchive(src)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CheckExtractSpace(src, dst); err != nil {
+		return nil, err
+	}
+	if err := CreateDir(dst); err != nil {
+		return nil, err
+	}
+	guard, err := NewArchiveGuard(dst, opts, info.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithField("src", src).WithField("dest", dst).Info("Extracting")
+	return extractFile(ctx, src, guard, opts, nil)
+}
+
+// ExtractTarFile extracts the tar archive, uncompressed or compressed like Extract accepts, into
+// the dst folder. Other formats are rejected with ErrUnknownArchive before anything is written
+func ExtractTarFile(ctx context.Context, src, dst string, opts *ExtractOptions) (*ExtractResult, error) {
+	if err := CheckTarArchive(ctx, src); err != nil {
+		return nil, err
+	}
+	return Extract(ctx, src, dst, opts)
+}
+
+// CheckTarArchive returns ErrUnknownArchive unless the file is a tar archive, uncompressed or compressed
+func CheckTarArchive(ctx context.Context, src string) error {
+	format, err := detectFormat(ctx, src)
+	if err != nil {
+		return err
+	}
+	if format != ArchiveTar {
+		return fmt.Errorf("%s: %w: %s instead of a tar archive", src, ErrUnknownArchive, format)
+	}
+	return nil
+}
+
+// detectFormat returns the format of the archive decompressing only its first block
+func detectFormat(ctx context.Context, src string) (string, error) {
+	f, compression, err := openArchive(src)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if compression == CompressionZip {
+		return ArchiveZip, nil
+	}
+	format, _, closer, err := openStream(ctx, f, src, compression)
+	if err != nil {
+		return "", err
+	}
+	closer.Close()
+	return format, nil
+}
+
+// ExtractTar extracts the uncompressed tar stream into the dst folder, see Extract.
+// The compression ratio isn't limited as the size of the archive is unknown
+func ExtractTar(ctx context.Context, r io.Reader, dst string, opts *ExtractOptions) (*ExtractResult, error) {
+	if opts == nil {
+		opts = &ExtractOptions{}
+	}
+	if err := CreateDir(dst); err != nil {
+		return nil, err
+	}
+	guard, err := NewArchiveGuard(dst, opts, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	x := newExtractor(guard, opts, nil)
+	x.result.Format = ArchiveTar
+	x.result.Compression = CompressionNone
+	if err := walkTar(contextReader(ctx, r), x.entry); err != nil {
+		return x.result, err
+	}
+	return x.finish()
+}
+
+// extractFile extracts the archive, progress receives the number of written bytes if it's set
+func extractFile(ctx context.Context, src string, guard *ArchiveGuard, opts *ExtractOptions, progress func(n int64)) (*ExtractResult, error) {
+	x := newExtractor(guard, opts, progress)
+	format, compression, err := walkArchive(ctx, src, x.entry)
+	x.result.Format, x.result.Compression = format, compression
+	if err != nil {
+		return x.result, err
+	}
+	return x.finish()
+}
+
+// openArchive opens the file and detects its compression, 7z archives are rejected
+func openArchive(src string) (*os.File, Compression, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, "", err
+	}
+
+	header := make([]byte, compressionMagicSize)
+	n, _ := io.ReadFull(f, header)
+	header = header[:n]
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, "", err
+	}
+
+	if bytes.HasPrefix(header, sevenZipMagic) {
+		f.Close()
+		return nil, "", fmt.Errorf("%s: %w: 7z", src, ErrUnsupportedArchive)
+	}
+	return f, DetectCompression(header), nil
+}
+
+// openStream decompresses the file and detects the format of the content, the reader
+// is buffered so the tar header can be peeked
+func openStream(ctx context.Context, f *os.File, src string, compression Compression) (string, *bufio.Reader, io.Closer, error) {
+	r, err := NewDecompressor(compression, f)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	br := bufio.NewReaderSize(contextReader(ctx, r), 64*1024)
+	block, _ := br.Peek(512)
+	if isTarHeader(block) {
+		return ArchiveTar, br, r, nil
+	}
+	if compression == CompressionNone {
+		r.Close()
+		return "", nil, nil, fmt.Errorf("%s: %w", src, ErrUnknownArchive)
+	}
+	return ArchiveFile, br, r, nil
+}
+
+// singleFileName is the name of the decompressed file, the source without the compression suffix
+func singleFileName(src string) string {
+	name := strings.TrimSuffix(filepath.Base(src), filepath.Ext(src))
+	if name == filepath.Base(src) || name == "" {
+		name = filepath.Base(src) + ".out"
+	}
+	return name
+}
+
+// isTarHeader validates the checksum of the first tar block
+func isTarHeader(block []byte) bool {
+	if len(block) < 512 {
+		return false
+	}
+	if string(block[257:262]) == "ustar" {
+		return true
+	}
+
+	// v7 archives have no magic, the checksum is the sum of the block with the checksum field as spaces
+	sum := strings.TrimRight(strings.TrimSpace(string(block[148:156])), "\x00")
+	var expected, actual int64
+	if _, err := fmt.Sscanf(sum, "%o", &expected); err != nil {
+		return false
+	}
+	for i, b := range block {
+		if i >= 148 && i < 156 {
+			b = ' '
+		}
+		actual += int64(b)
+	}
+	return expected == actual && block[0] != 0
+}
+
+// extractor writes the entries of an archive walked by walkArchive
+type extractor struct {
+	guard    *ArchiveGuard
+	opts     *ExtractOptions
+	progress func(n int64)
+	result   *ExtractResult
+	// times of folders are set at the end as writing their files changes them
+	dirTimes map[string]time.Time
+}
+
+func newExtractor(guard *ArchiveGuard, opts *ExtractOptions, progress func(n int64)) *extractor {
+	if opts == nil {
+		opts = &ExtractOptions{}
+	}
+	return &extractor{guard: guard, opts: opts, progress: progress, result: &ExtractResult{}, dirTimes: map[string]time.Time{}}
+}
+
+func (x *extractor) entry(e *ArchiveEntry, open func() (io.ReadCloser, error)) error {
+	if err := x.guard.Entry(e.Name); err != nil {
+		return err
+	}
+	name, ok := stripComponents(e.Name, x.opts.StripComponents)
+	if !ok || !x.selected(name) {
+		return nil
+	}
+
+	var path, target string
+	var err error
+	switch e.Type {
+	case EntrySymlink:
+		path, err = x.guard.Symlink(name, e.Linkname)
+	case EntryLink:
+		// hardlink targets are names in the archive, they are stripped the same way
+		linkname, ok := stripComponents(e.Linkname, x.opts.StripComponents)
+		if !ok {
+			return nil
+		}
+		path, target, err = x.guard.Link(name, linkname)
+	default:
+		path, err = x.guard.Path(name)
+	}
+	if err != nil || path == "" {
+		return err
+	}
+
+	if x.opts.Callback != nil {
+		if err := x.opts.Callback(e, path); errors.Is(err, ErrSkipEntry) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	if e.Type != EntryDir {
+		if keep, err := keepExisting(path, e, x.opts.Overwrite); err != nil || keep {
+			return err
+		}
+	}
+
+	mode := e.Mode.Perm()
+	switch e.Type {
+	case EntryDir:
+		if err := makeDir(path, mode|0700); err != nil {
+			return err
+		}
+		x.dirTimes[path] = e.ModTime
+	case EntryFile:
+		if mode == 0 {
+			mode = 0644
+		}
+		rc, err := open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		r := x.guard.Reader(e.Name, rc)
+		if x.progress != nil {
+			r = io.TeeReader(r, writerFunc(func(p []byte) (int, error) {
+				x.progress(int64(len(p)))
+				return len(p), nil
+			}))
+		}
+		if err := writeFile(path, r, mode); err != nil {
+			return err
+		}
+		x.result.Files = append(x.result.Files, path)
+	case EntrySymlink:
+		if err := writeSymlink(path, e.Linkname); err != nil {
+			return err
+		}
+	case EntryLink:
+		// the target may be left out by the patterns
+		if _, err := os.Lstat(target); os.IsNotExist(err) {
+			log.Debug("Skipping hardlink ", e.Name, " to not extracted ", e.Linkname)
+			return nil
+		}
+		os.Remove(path)
+		if err := os.Link(target, path); err != nil {
+			return err
+		}
+	default:
+		log.Debug("Skipping archive entry ", e.Name, " of type ", e.Type)
+		return nil
+	}
+
+	if x.opts.PreserveOwner && runtime.GOOS != "windows" {
+		if err := os.Lchown(path, e.Uid, e.Gid); err != nil {
+			return err
+		}
+	}
+	if e.Type == EntryFile || e.Type == EntryLink {
+		if err := os.Chtimes(path, e.ModTime, e.ModTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finish sets the times of the folders, verifies the symlinks and lists the images
+func (x *extractor) finish() (*ExtractResult, error) {
+	for dir, mtime := range x.dirTimes {
+		// a later entry may have replaced the folder, links aren't followed
+		if info, err := os.Lstat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		if err := os.Chtimes(dir, mtime, mtime); err != nil {
+			return x.result, err
+		}
+	}
+	if err := x.guard.Verify(); err != nil {
+		return x.result, err
+	}
+
+	suffixes := x.opts.ImageSuffixes
+	if suffixes == nil {
+		suffixes = defaultImageSuffixes
+	}
+	for _, file := range x.result.Files {
+		if HasAnySuffixes(strings.ToLower(file), suffixes...) {
+			x.result.Images = append(x.result.Images, file)
+		}
+	}
+	return x.result, nil
+}
+
+// selected applies Patterns and Exclude
+func (x *extractor) selected(name string) bool {
+	if len(x.opts.Patterns) > 0 && !MatchArchiveName(name, x.opts.Patterns...) {
+		return false
+	}
+	return !MatchArchiveName(name, x.opts.Exclude...)
+}
+
+// stripComponents removes n leading folders of the name, false is returned if nothing is left
+func stripComponents(name string, n int) (string, bool) {
+	if n <= 0 || path.IsAbs(name) || strings.Contains("/"+name+"/", "/../") {
+		// unsafe names are left to the guard
+		return name, true
+	}
+	parts := strings.SplitN(path.Clean(name), "/", n+1)
+	if len(parts) <= n {
+		return "", false
+	}
+	return parts[n], true
+}
+
+// keepExisting applies the overwrite policy to the existing file
+func keepExisting(path string, e *ArchiveEntry, policy Overwrite) (bool, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false, nil
+	}
+	switch policy {
+	case OverwriteNever:
+		return true, nil
+	case OverwriteNewer:
+		return !e.ModTime.After(info.ModTime()), nil
+	case OverwriteError:
+		return false, fmt.Errorf("%s: %w", path, os.ErrExist)
+	}
+	return false, nil
+}
+
+// makeDir creates the folder and sets its mode, an existing symlink is replaced
+// so the mode of its target isn't changed
+func makeDir(path string, mode os.FileMode) error {
+	if info, err := os.Lstat(path); err == nil && !info.IsDir() {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(path, mode); err != nil {
+		return err
+	}
+	return os.Chmod(path, mode)
+}
+
+// writeSymlink replaces the path with a symlink
+func writeSymlink(path, linkname string) error {
+	if err := CreateDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	os.Remove(path)
+	return os.Symlink(linkname, path)
+}
+
+// writeFile writes the file creating its folder, an existing file is overwritten
+func writeFile(path string, r io.Reader, mode os.FileMode) error {
+	if err := CreateDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	// an existing symlink is replaced rather than written through
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		os.Remove(path)
+	}
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// contextReader stops reading once the context is cancelled
+func contextReader(ctx context.Context, r io.Reader) io.Reader {
+	return readerFunc(func(p []byte) (int, error) {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		return r.Read(p)
+	})
+}
+
+// readerFunc is a function used as an io.Reader
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
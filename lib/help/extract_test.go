@@ -0,0 +1,179 @@
+package help
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+type testEntry struct {
+	name     string
+	body     string
+	typeflag byte
+	linkname string
+}
+
+func writeTestTar(w io.Writer, entries []testEntry) {
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.body)), Typeflag: e.typeflag, Linkname: e.linkname}
+		switch e.typeflag {
+		case tar.TypeDir:
+			hdr.Mode = 0755
+		case tar.TypeSymlink, tar.TypeLink:
+			hdr.Size = 0
+		case 0:
+			hdr.Typeflag = tar.TypeReg
+		}
+		tw.WriteHeader(hdr)
+		tw.Write([]byte(e.body))
+	}
+	tw.Close()
+}
+
+func writeTestZip(w io.Writer, entries []testEntry) {
+	zw := zip.NewWriter(w)
+	for _, e := range entries {
+		f, _ := zw.Create(e.name)
+		f.Write([]byte(e.body))
+	}
+	zw.Close()
+}
+
+// compressTest compresses the data with the writer of the format
+func compressTest(compression Compression, data []byte) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch compression {
+	case CompressionGzip:
+		w = gzip.NewWriter(&buf)
+	case CompressionXz:
+		w, _ = xz.NewWriter(&buf)
+	case CompressionZstd:
+		w, _ = zstd.NewWriter(&buf)
+	default:
+		return data
+	}
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestExtract(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extract")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	entries := []testEntry{
+		{name: "boot/", typeflag: tar.TypeDir},
+		{name: "boot/config.txt", body: "dtparam=audio=on"},
+		{name: "raspbian lite.img", body: "disk image"},
+		{name: "latest.img", typeflag: tar.TypeSymlink, linkname: "raspbian lite.img"},
+	}
+	var tarBuf, zipBuf bytes.Buffer
+	writeTestTar(&tarBuf, entries)
+	writeTestZip(&zipBuf, entries[1:3])
+
+	tests := []struct {
+		name        string
+		data        []byte
+		format      string
+		compression Compression
+		files       []string
+		images      []string
+	}{
+		{"image.tar", tarBuf.Bytes(), ArchiveTar, CompressionNone, []string{"boot/config.txt", "raspbian lite.img"}, []string{"raspbian lite.img"}},
+		{"image.tgz", compressTest(CompressionGzip, tarBuf.Bytes()), ArchiveTar, CompressionGzip, []string{"boot/config.txt", "raspbian lite.img"}, []string{"raspbian lite.img"}},
+		{"image.tar.xz", compressTest(CompressionXz, tarBuf.Bytes()), ArchiveTar, CompressionXz, []string{"boot/config.txt", "raspbian lite.img"}, []string{"raspbian lite.img"}},
+		{"image.tar.zst", compressTest(CompressionZstd, tarBuf.Bytes()), ArchiveTar, CompressionZstd, []string{"boot/config.txt", "raspbian lite.img"}, []string{"raspbian lite.img"}},
+		// the suffix doesn't matter
+		{"image.bin", zipBuf.Bytes(), ArchiveZip, CompressionZip, []string{"boot/config.txt", "raspbian lite.img"}, []string{"raspbian lite.img"}},
+		{"tinker.img.xz", compressTest(CompressionXz, []byte("disk image")), ArchiveFile, CompressionXz, []string{"tinker.img"}, []string{"tinker.img"}},
+		{"tinker.img.gz", compressTest(CompressionGzip, []byte("disk image")), ArchiveFile, CompressionGzip, []string{"tinker.img"}, []string{"tinker.img"}},
+	}
+	for _, tt := range tests {
+		src := filepath.Join(dir, tt.name)
+		dst := filepath.Join(dir, tt.name+".d")
+		ioutil.WriteFile(src, tt.data, 0644)
+
+		result, err := Extract(context.Background(), src, dst, nil)
+		if err != nil {
+			t.Errorf("%q. Extract() error = %v", tt.name, err)
+			continue
+		}
+		if result.Format != tt.format || result.Compression != tt.compression {
+			t.Errorf("%q. Extract() = %s %q, want %s %q", tt.name, result.Format, result.Compression, tt.format, tt.compression)
+		}
+		if got := relPaths(dst, result.Files); !equalStrings(got, tt.files) {
+			t.Errorf("%q. Extract() files = %q, want %q", tt.name, got, tt.files)
+		}
+		if got := relPaths(dst, result.Images); !equalStrings(got, tt.images) {
+			t.Errorf("%q. Extract() images = %q, want %q", tt.name, got, tt.images)
+		}
+		for _, file := range result.Images {
+			if data, _ := ioutil.ReadFile(file); string(data) != "disk image" {
+				t.Errorf("%q. Extract() wrote %q into %s", tt.name, data, file)
+			}
+		}
+	}
+
+	if link, err := os.Readlink(filepath.Join(dir, "image.tar.d", "latest.img")); err != nil || link != "raspbian lite.img" {
+		t.Errorf("Extract() symlink = %q, %v", link, err)
+	}
+}
+
+func TestExtractUnknown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extract")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	plain := filepath.Join(dir, "readme.txt")
+	ioutil.WriteFile(plain, []byte("not an archive"), 0644)
+	if _, err := Extract(context.Background(), plain, dir, nil); !errors.Is(err, ErrUnknownArchive) {
+		t.Errorf("Extract() error = %v, want ErrUnknownArchive", err)
+	}
+
+	sevenZip := filepath.Join(dir, "image.7z")
+	ioutil.WriteFile(sevenZip, append(sevenZipMagic, 0, 4), 0644)
+	if _, err := Extract(context.Background(), sevenZip, dir, nil); !errors.Is(err, ErrUnsupportedArchive) {
+		t.Errorf("Extract() error = %v, want ErrUnsupportedArchive", err)
+	}
+}
+
+func relPaths(base string, paths []string) []string {
+	var rel []string
+	for _, p := range paths {
+		r, _ := filepath.Rel(base, p)
+		rel = append(rel, filepath.ToSlash(r))
+	}
+	sort.Strings(rel)
+	return rel
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -3,18 +3,16 @@ package help
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
-	"mime"
 	"net"
-	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
-	"path"
 	"path/filepath"
 	"regexp"
 	"runtime"
@@ -66,6 +64,9 @@ func UserHomeDir() string {
 }
 
 // Returns extract command based on the filename
+//
+// Deprecated: the commands need external tools, use Extract, or List and ExtractMatching
+// to find and extract the images only
 func GetExtractCommand(file string) string {
 	if HasAnySuffixes(file, ".tar.gz", ".tgz", ".tar.bz2", ".tbz", ".tar.xz") {
 		return "tar xvf %s -C %s"
@@ -270,266 +271,26 @@ func DeleteDir(dir string) error {
 // download file if does not already exist
 // shows progress bar
 func DownloadFromUrl(url, destination string) (string, error) {
-	var (
-		timeout time.Duration = time.Duration(0)
-		client  http.Client   = http.Client{Timeout: timeout}
-	)
-	//tokenize url
-	tokens := strings.Split(url, "/")
-	//obtain file name
-	fileName := tokens[len(tokens)-1]
-
-	// check maybe downloaded file exists and corrupted
-	fullFileName := filepath.Join(destination, fileName)
-	if _, err := os.Stat(fullFileName); !os.IsNotExist(err) {
-
-		downloadedFileLength, _ := GetFileLength(fullFileName)
-		sourceFileLength, _ := GetHTTPFileLength(url)
-
-		if sourceFileLength != downloadedFileLength && sourceFileLength != 0 {
-			fmt.Printf("[+] Delete corrupted cached file %s\n", fullFileName)
-			DeleteFile(fullFileName)
-		}
-		// otherwise file has correct length
-	}
-
-	fmt.Printf("[+] Downloading %s from %s to %s\n", fileName, url, destination)
-
-	//target file does not exist
-	if _, err := os.Stat(fullFileName); os.IsNotExist(err) {
-		//create destination dir
-		CreateDir(destination)
-		//create file
-		output, err := os.Create(fullFileName)
-		if err != nil {
-			log.Error("[-] Error creating file ", destination, fileName)
-			return "", err
-		}
-		defer output.Close()
-		response, err := client.Get(url)
-		if err != nil {
-			log.Error("[-] Error while downloading file ", url)
-			return "", err
-		}
-		defer response.Body.Close()
-		bar := pb.New64(response.ContentLength)
-		bar.ShowBar = false
-		bar.SetWidth(100)
-		bar.Start()
-		prd := bar.NewProxyReader(response.Body)
-		totalCount, err := io.Copy(output, prd)
-		if err != nil {
-			log.Error("error while copying ", err.Error())
-			return "", err
-		}
-		log.Debug("Total number of bytes read: ", totalCount)
-	} else {
-		fmt.Printf("[+] File exist %s%s\n", destination, fileName)
-	}
-	fmt.Println("\n[+] Done")
-	return fileName, nil
+	return NewDownloader().Download(context.Background(), url, destination)
 }
 
+// DownloadQuiet downloads target file to destination folder without any output
 func DownloadQuiet(url, destination string) (string, error) {
-	var (
-		timeout time.Duration = time.Duration(0)
-		client  http.Client   = http.Client{Timeout: timeout}
-	)
-	//tokenize url
-	tokens := strings.Split(url, "/")
-	//obtain file name
-	fileName := tokens[len(tokens)-1]
-
-	// check maybe downloaded file exists and corrupted
-	fullFileName := filepath.Join(destination, fileName)
-	if _, err := os.Stat(fullFileName); !os.IsNotExist(err) {
-
-		downloadedFileLength, _ := GetFileLength(fullFileName)
-		sourceFileLength, _ := GetHTTPFileLength(url)
-
-		if sourceFileLength != downloadedFileLength && sourceFileLength != 0 {
-			DeleteFile(fullFileName)
-		} else {
-			// otherwise file has correct length
-			return fileName, nil
-		}
-	}
-
-	//create destination dir
-	CreateDir(destination)
-	//create file
-	output, err := os.Create(fullFileName)
-	if err != nil {
-		log.Error("[-] Error creating file ", destination, fileName)
-		return "", err
-	}
-	defer output.Close()
-	response, err := client.Get(url)
-	if err != nil {
-		log.Error("[-] Error while downloading file ", url)
-		return "", err
-	}
-	defer response.Body.Close()
-	totalCount, err := io.Copy(output, response.Body)
-	if err != nil {
-		log.Error("error while copying ", err.Error())
-		return "", err
-	}
-	log.Debug("Total number of bytes read: ", totalCount)
-	return fileName, nil
+	d := NewDownloader()
+	d.Quiet = true
+	return d.Download(context.Background(), url, destination)
 }
 
 func Exists(fullFileName string) bool {
 	return DirExists(fullFileName)
 }
 
-// DownloadFromUrl downloads target file to destination folder,
+// DownloadFromUrlAsync downloads target file to destination folder in background,
 // creates destination dir if does not exist
-// download file if does not already exist
-// shows progress bar
+// resumes download if the file is partially downloaded
+// sends the number of read bytes into the readBytesChannel
 func DownloadFromUrlAsync(url, destination string, readBytesChannel chan int64, errorChan chan error) (string, int64, error) {
-	var (
-		timeout  time.Duration = time.Duration(0)
-		client   http.Client   = http.Client{Timeout: timeout}
-		fileName               = "latest"
-		length   int64
-	)
-	response, err := client.Get(url)
-	if err != nil {
-		log.Error("Error while downloading file from:", url, " error msg:", err.Error())
-		return "", 0, err
-	}
-	contentDisposition := response.Header.Get("Content-Disposition")
-	_, params, err := mime.ParseMediaType(contentDisposition)
-	if err != nil {
-		tokens := strings.Split(url, "/")
-		fileName = tokens[len(tokens)-1]
-		// log.Error("Error parsing media type ", "error msg:", err.Error())
-	} else {
-		fileName = params["filename"]
-	}
-	length = response.ContentLength
-	// check maybe downloaded file exists
-	fullFileName := filepath.Join(destination, fileName)
-	if Exists(fullFileName) {
-		downloadedFileLength, _ := GetFileLength(fullFileName)
-		sourceFileLength, _ := GetHTTPFileLength(url)
-		if sourceFileLength > downloadedFileLength && sourceFileLength != 0 {
-			log.Debug("Missing bytes. Resuming download")
-			go resumeDownloadAsync(fullFileName, url, readBytesChannel, errorChan)
-		} else {
-			//report full length
-			readBytesChannel <- downloadedFileLength
-			//close channel
-			close(readBytesChannel)
-			close(errorChan)
-			return fileName, downloadedFileLength, nil
-		}
-	} else { //file does not exist, download file
-		CreateDir(destination)
-		//create file
-		output, err := os.Create(fmt.Sprintf("%s%s%s", destination, Separator(), fileName))
-		if err != nil {
-			log.Error("Error creating file ", destination, fileName)
-			return "", 0, err
-		}
-		// ASYNC part. Download file in background and send read bytes into the readBytesChannel channel
-		go func(resp *http.Response, ch chan int64, output *os.File, errorChan chan error) {
-			defer response.Body.Close()
-			defer close(ch)
-			defer output.Close()
-			defer close(errorChan)
-			prd := NewHttpProxyReader(response.Body, func(n int, err error) {
-				ch <- int64(n)
-				if err != nil {
-					if err.Error() == "EOF" {
-						return
-					}
-					log.WithField("err", err).Error("error occured, sending error down the channel")
-					errorChan <- err
-					return
-				}
-			})
-
-			totalCount, err := io.Copy(output, prd)
-			if err != nil {
-				log.Error("error while copying ", err.Error())
-				errorChan <- err
-				return
-			}
-			log.Debug("Total number of bytes read: ", totalCount)
-
-		}(response, readBytesChannel, output, errorChan)
-	}
-	return fileName, length, nil
-}
-
-func resumeDownloadAsync(dst, url string, ch chan int64, errorChan chan error) {
-	log.Debug("resuming download to ", dst)
-	//resolve redirects to final url
-	defer close(ch)
-	defer close(errorChan)
-	final_url, err := GetFinalUrl(url)
-	if err != nil {
-		log.Error("http.Get :", err.Error())
-	}
-	log.Debug("Final resolved URL:", final_url)
-	local_length, err := GetFileLength(dst)
-	if err != nil {
-		log.Error("error getting file length from:", dst, " error msg:", err.Error())
-		return
-	}
-	remote_length, err := GetHTTPFileLength(final_url)
-	if err != nil {
-		log.Error("error getting remote file length from:", final_url, "error msg:", err.Error())
-		return
-	}
-	log.Debug("Current file size: ", local_length, " remote file length:", remote_length)
-	if local_length < remote_length {
-		log.Debug("Downloading : ", strconv.FormatInt(remote_length-local_length-1, 10), " bytes")
-		//send actual size of the file
-		ch <- local_length
-		client := &http.Client{}
-		req, err := http.NewRequest("GET", final_url, nil)
-		if err != nil {
-			log.Error("error creating GET request to ", final_url, " error msg:", err.Error())
-			return
-		}
-		range_header := "bytes=" + strconv.FormatInt(local_length, 10) + "-"
-		//"-" + strconv.FormatInt(remote_length-1, 10) + "/" + strconv.FormatInt(remote_length, 10)
-		req.Header.Add("Range", range_header)
-		log.Debug("Adding Range header:", range_header)
-		resp, err := client.Do(req)
-		defer resp.Body.Close()
-		if err != nil {
-			log.Error("error making GET request to ", final_url, " error msg:", err.Error())
-			return
-		}
-		log.Debug("Received content length:", resp.ContentLength)
-		if resp.StatusCode != http.StatusPartialContent {
-			log.Debug("HTTP status code:", resp.StatusCode)
-			log.Error("Server does not support Range header, cannot resume download.")
-			fmt.Println("\n[-] Server does not support Range header. Cannot resume download. Delete your old file and re-run your command again")
-			return
-		}
-
-		prd := NewHttpProxyReader(resp.Body, func(n int, err error) {
-			ch <- int64(n)
-			if err != nil {
-				errorChan <- err
-			}
-		})
-		output, err := os.OpenFile(dst, os.O_APPEND|os.O_WRONLY, 0600)
-		defer output.Close()
-		if err != nil {
-			log.Error("error opening file ", "error msg:", err.Error())
-		}
-		totalCount, err := io.Copy(output, prd)
-		if err != nil {
-			log.Error("error while copying ", err.Error())
-		}
-		log.Debug("Total number of bytes read: ", totalCount)
-	}
+	return NewDownloader().DownloadAsync(context.Background(), url, destination, readBytesChannel, errorChan)
 }
 
 func GetFileLength(path string) (int64, error) {
@@ -547,168 +308,122 @@ func GetFileLength(path string) (int64, error) {
 	return stat.Size(), nil
 }
 
+// GetHTTPFileLength returns the length of the remote file
 func GetHTTPFileLength(url string) (int64, error) {
-	var (
-		timeout time.Duration = time.Duration(0)
-		client  http.Client   = http.Client{Timeout: timeout}
-	)
-
-	response, err := client.Get(url)
+	info, err := RemoteInfo(url)
 	if err != nil {
 		return 0, errors.New("Can't retrieve length of http source " + url)
 	}
 
-	return response.ContentLength, nil
+	return info.Length, nil
 }
 
+// GetFinalUrl returns the url after following redirects
 func GetFinalUrl(url string) (string, error) {
-	resp, err := http.Get(url)
+	info, err := RemoteInfo(url)
 	if err != nil {
 		return "", err
 	}
-	return resp.Request.URL.String(), nil
+	return info.URL, nil
 }
 
 // Downloads From url with retries
 func DownloadFromUrlWithAttempts(url, destination string, retries int) (string, error) {
-	var (
-		err      error
-		filename string
-	)
-	for i := 1; i <= retries; i++ {
-		fmt.Printf("[+] Attempting to download. Trying %d out of %d \n", i, retries)
-		filename, err = DownloadFromUrl(url, destination)
-		if err == nil {
-			break
-		} else {
-			DeleteFile(filepath.Join(destination, filename))
-		}
-	}
+	d := NewDownloader()
+	d.Retries = retries
+	return d.Download(context.Background(), url, destination)
+}
+
+// DownloadFromMirrors downloads the same file from the first available mirror,
+// switching to the next mirror when the download fails
+func DownloadFromMirrors(mirrors []string, destination string, retries int) (string, error) {
+	d := NewDownloader()
+	d.Retries = retries
+	report, err := d.DownloadMirrors(context.Background(), mirrors, destination, MirrorsInOrder)
 	if err != nil {
-		fmt.Printf("[-] Could not download from url:%s \n", url)
-		fmt.Printf("[-] Reported error message:%s\n", err.Error())
 		return "", err
 	}
-	return filename, nil
+	return report.FileName, nil
 }
 
 // Downloads From url with retries
 func DownloadQuietAttempts(url, destination string, retries int) (string, error) {
-	var (
-		err      error
-		filename string
-	)
-	for i := 1; i <= retries; i++ {
-		filename, err = DownloadQuiet(url, destination)
-		if err == nil {
-			break
-		} else {
-			DeleteFile(filepath.Join(destination, filename))
-		}
-	}
+	d := NewDownloader()
+	d.Quiet = true
+	d.Retries = retries
+	filename, err := d.Download(context.Background(), url, destination)
 	if err != nil {
-		fmt.Printf("[-] Could not download from url: %s \n", url)
+		fmt.Printf("[-] Could not download from url: %s \n", redactURL(url))
 		fmt.Printf("[-] Reported error message:%s\n", err.Error())
 		return "", err
 	}
 	return filename, nil
 }
 
-// Downloads from the url asynchronously
+// DownloadFromUrlWithAttemptsAsync downloads the url in background updating the returned progress bar,
+// the wait group is done when the download is over. Errors of the download are logged,
+// use DownloadWithErrorsAsync to receive them
 func DownloadFromUrlWithAttemptsAsync(url, destination string, retries int, wg *sync.WaitGroup) (string, *pb.ProgressBar, error) {
-	var (
-		err                     error
-		filename                string
-		destinationFileNameFull string
-		length                  int64
-		readBytesChannel        = make(chan int64, 10000)
-		errorChan               = make(chan error, 1)
-	)
-	bar := pb.New64(0)
-	bar.ShowBar = false
-	bar.SetUnits(pb.U_BYTES)
-	wg.Add(1)
-	go func(ch chan int64, wg *sync.WaitGroup, errorChan chan error, filename *string, url string) {
-		// complete task after closing channel
-		defer wg.Done()
-		for {
-			select {
-			case n, ok := <-ch:
-				if !ok {
-					ch = nil
-					// log.Debug("Bytes chan is closed")
-				}
-				bar.Add64(n)
-			case err, ok := <-errorChan:
-				if !ok {
-					errorChan = nil
-					// log.Debug("Error chan is closed")
-				}
-				if err != nil {
-					// compare length of files, if length is the same - file is downloaded
-					fileLength, _ := GetFileLength(*filename)
-					urlFileLength, _ := GetHTTPFileLength(url)
-					if fileLength != urlFileLength {
-						fmt.Println("[-] Error occured with error message:", err.Error())
-						log.Error("Error occured while downloading remote file ", "error msg:", err.Error())
-						os.Exit(1)
-					}
-				}
-			}
-			if ch == nil && errorChan == nil {
-				break
-			}
-
-		}
+	return DownloadWithErrorsAsync(url, destination, retries, wg, nil)
+}
 
-	}(readBytesChannel, wg, errorChan, &destinationFileNameFull, url)
+// DownloadWithErrorsAsync is DownloadFromUrlWithAttemptsAsync which sends the error of the download into
+// the errorChan if it's not nil, the channel should be buffered as nobody may be reading it
+func DownloadWithErrorsAsync(url, destination string, retries int, wg *sync.WaitGroup, errorChan chan<- error) (string, *pb.ProgressBar, error) {
+	d := NewDownloader()
+	d.Retries = retries
 
-	if filename, length, err = DownloadFromUrlAsync(url, destination, readBytesChannel, errorChan); err != nil {
-		fmt.Printf("[-] Could not download from url:%s \n", url)
-		fmt.Printf("[-] Reported error message:%s\n", err.Error())
-		close(readBytesChannel)
-		close(errorChan)
+	info, err := d.RemoteInfo(context.Background(), url)
+	if err != nil {
+		log.Error("Could not download from url:", redactURL(url), " error msg:", err.Error())
 		return "", nil, err
-	} else {
-		bar.Total = length
 	}
 
-	destinationFileNameFull = path.Join(destination, filename)
-
-	return filename, bar, nil
-
-}
+	// the total is known before the bar is returned, the goroutine only moves it
+	bar := pb.New64(info.Length)
+	bar.ShowBar = false
+	bar.SetUnits(pb.U_BYTES)
 
-func DownloadFile(dst string, url string) (err error) {
-	if Exists(dst) {
-		downloadedFileLength, _ := GetFileLength(dst)
-		sourceFileLength, _ := GetHTTPFileLength(url)
-		if downloadedFileLength == sourceFileLength {
-			return nil
+	d.FileName = info.FileName
+	d.Progress = ProgressFunc(func(e ProgressEvent) {
+		switch e.Type {
+		case ProgressStarted:
+			bar.Set64(e.Offset)
+		case ProgressBytes:
+			bar.Add64(e.N)
+		case ProgressRetried:
+			bar.Set64(0)
+		case ProgressFinished:
+			bar.Set64(bar.Total)
 		}
-		DeleteFile(dst)
-	}
-	out, err := os.Create(dst)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
+	})
 
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, err := d.downloadKnown(context.Background(), url, destination, info); err != nil {
+			log.Error("Error occured while downloading remote file ", redactURL(url), " error msg:", err.Error())
+			if errorChan != nil {
+				errorChan <- err
+			}
+		}
+	}()
 
-	_, err = io.Copy(out, resp.Body)
-	if err != nil {
-		return err
-	}
+	return info.FileName, bar, nil
+}
 
-	return nil
+// DownloadFile downloads the url into the dst file
+func DownloadFile(dst string, url string) (err error) {
+	d := NewDownloader()
+	d.Quiet = true
+	d.FileName = filepath.Base(dst)
+	_, err = d.Download(context.Background(), url, filepath.Dir(dst))
+	return err
 }
 
 // GetZipFiles - gets the list of files inside zip archive
+//
+// Deprecated: the archive is closed when it returns so the files can't be opened, use List
 func GetZipFiles(src string) ([]*zip.File, error) {
 	var files []*zip.File
 	r, err := zip.OpenReader(src)
@@ -723,60 +438,42 @@ func GetZipFiles(src string) ([]*zip.File, error) {
 	return files, nil
 }
 
-// Unzip into the destination folder
+// Unzip into the destination folder, entries with unsafe paths and archives exceeding
+// the default limits of ExtractOptions are rejected
 func Unzip(src, dest string) error {
-	dest = dest + Separator()
 	log.WithField("src", src).WithField("dest", dest).Info("Unzipping")
-	tokens := strings.Split(src, Separator())
-	fileName := tokens[len(tokens)-1]
+	fileName := filepath.Base(src)
 	// create destination dir with 0777 access rights
-	CreateDir(dest)
-	r, err := zip.OpenReader(src)
-	if err != nil {
+	if err := CreateDir(dest); err != nil {
 		return err
 	}
 
-	var total64 int64
-	for _, file := range r.File {
-		total64 += int64(file.UncompressedSize64)
+	total64, err := zipSize(src)
+	if err != nil {
+		return err
+	}
+	if err := CheckSpace(dest, total64); err != nil {
+		fmt.Println("[-] ", err.Error())
+		return err
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	guard, err := NewArchiveGuard(dest, nil, info.Size())
+	if err != nil {
+		return err
 	}
+
 	bar := pb.New64(total64).SetUnits(pb.U_BYTES)
 	bar.ShowBar = false
 	bar.SetMaxWidth(80)
 	bar.Prefix(fmt.Sprintf("[+] Unzipping %-15s", fileName))
-	for _, f := range r.File {
-		bar.Start()
-		rc, err := f.Open()
-		if err != nil {
-			fmt.Println("[-] ", err.Error())
-			return err
-		}
-		defer rc.Close()
-		fpath := filepath.Join(dest, filepath.FromSlash(f.Name))
-		if f.FileInfo().IsDir() {
-			CreateDir(fpath)
-		} else {
-			var fdir string
-			if lastIndex := strings.LastIndex(fpath, Separator()); lastIndex > -1 {
-				fdir = fpath[:lastIndex]
-			}
-			if err := CreateDir(fdir); err != nil {
-				fmt.Println("[-] ", err.Error())
-				return err
-			}
-			dst_f, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
-			if err != nil {
-				fmt.Println("[-] ", err.Error())
-				return err
-			}
-			defer dst_f.Close()
-			copied, err := io.Copy(dst_f, rc)
-			if err != nil {
-				fmt.Println("[-] ", err.Error())
-				return err
-			}
-			bar.Add64(copied)
-		}
+	bar.Start()
+	if _, err := extractFile(context.Background(), src, guard, nil, func(n int64) { bar.Add64(n) }); err != nil {
+		bar.Finish()
+		fmt.Println("[-] ", err.Error())
+		return err
 	}
 	bar.Finish()
 	time.Sleep(time.Second * 2)
@@ -983,8 +680,15 @@ func Copy(src, dst string) error {
 	return os.Chmod(dst, sourceInfo.Mode())
 }
 
-// Copy a directory recursively
+// Copy a directory recursively, fails before copying if it doesn't fit into the destination
 func CopyDir(src, dst string) error {
+	if err := CheckCopySpace(src, dst); err != nil {
+		return err
+	}
+	return copyDir(src, dst)
+}
+
+func copyDir(src, dst string) error {
 	// get properties of source dir
 	sourceInfo, err := os.Stat(src)
 	if err != nil {
@@ -1004,7 +708,7 @@ func CopyDir(src, dst string) error {
 		dstp := dst + Separator() + obj.Name()
 		if obj.IsDir() {
 			// create sub-directories recursively
-			err = CopyDir(srcp, dstp)
+			err = copyDir(srcp, dstp)
 			if err != nil {
 				fmt.Println(err)
 			}
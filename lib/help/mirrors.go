@@ -0,0 +1,254 @@
+package help
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// MirrorOrder selects the mirror a download starts from
+type MirrorOrder int
+
+const (
+	// MirrorsInOrder starts from the first mirror which responds, keeping the given order
+	MirrorsInOrder MirrorOrder = iota
+	// MirrorsFastest probes all the mirrors at once and starts from the quickest to respond
+	MirrorsFastest
+)
+
+// ErrNoMirrors is returned when the mirror list is empty
+var ErrNoMirrors = errors.New("no mirrors given")
+
+// MirrorRange is a range of bytes [Start, End) of the downloaded file served by the mirror URL
+type MirrorRange struct {
+	URL   string
+	Start int64
+	End   int64
+}
+
+// MirrorReport describes a download from mirrors
+type MirrorReport struct {
+	FileName string
+	// Ranges lists which mirror served each part of the file, it's empty
+	// when the file was already downloaded or taken from the cache
+	Ranges []MirrorRange
+}
+
+// clip drops everything served from the offset on, as it's going to be downloaded again
+func (r *MirrorReport) clip(offset int64) {
+	ranges := r.Ranges[:0]
+	for _, mr := range r.Ranges {
+		if mr.Start >= offset {
+			continue
+		}
+		if mr.End > offset {
+			mr.End = offset
+		}
+		ranges = append(ranges, mr)
+	}
+	r.Ranges = ranges
+}
+
+// DownloadMirrors downloads the same file from a list of mirrors into the destination folder.
+// When a mirror fails the download continues from the next one, resuming the partial file by range
+// if the mirror serves the same file. Mirrors are tried in rounds according to the retry policy.
+// The file is named after the first mirror unless FileName is set
+func (d *Downloader) DownloadMirrors(ctx context.Context, mirrors []string, destination string, order MirrorOrder) (*MirrorReport, error) {
+	if len(mirrors) == 0 {
+		return nil, ErrNoMirrors
+	}
+
+	report := &MirrorReport{FileName: d.FileName}
+	if report.FileName == "" {
+		report.FileName = FileNameFromURL(mirrors[0])
+	}
+
+	digest, err := d.expectedDigest(ctx, report.FileName)
+	if err != nil {
+		return nil, err
+	}
+
+	fullFileName := filepath.Join(destination, report.FileName)
+	t := d.track(mirrors[0], fullFileName)
+	if d.Cache != nil {
+		for _, m := range mirrors {
+			if d.fromCache(ctx, m, digest, fullFileName) {
+				t.finish(true)
+				return report, nil
+			}
+		}
+	}
+
+	mirrors = d.orderMirrors(ctx, mirrors, order)
+
+	policy := d.retryPolicy()
+	started := time.Now()
+	for round := 1; ; round++ {
+		var retryErr error
+		for i, m := range mirrors {
+			var header http.Header
+			t.url = m
+			if header, err = d.downloadMirror(ctx, m, destination, fullFileName, digest, report, t); err == nil {
+				if d.Cache != nil {
+					d.toCache(m, fullFileName, digest, header)
+				}
+				t.finish(header == nil)
+				return report, nil
+			}
+			log.WithField("url", redactURL(m)).WithField("round", round).Error("Mirror failed: ", err.Error())
+			if ctx.Err() != nil {
+				t.fail(ctx.Err())
+				return report, ctx.Err()
+			}
+			if retryErr == nil && IsRetryable(err) {
+				retryErr = err
+			}
+			if i < len(mirrors)-1 {
+				// failing over to the next mirror immediately
+				t.retry(round, 0, err)
+			}
+		}
+
+		// the round is retried if any mirror failed transiently
+		if retryErr != nil {
+			err = retryErr
+		}
+		delay, retry := policy.Next(round, time.Since(started), err)
+		if !retry {
+			break
+		}
+		t.retry(round, delay, err)
+		if e := sleep(ctx, delay); e != nil {
+			t.fail(e)
+			return report, e
+		}
+	}
+
+	t.fail(err)
+	return report, err
+}
+
+// downloadMirror makes a single attempt to download from the mirror and records the bytes it served
+func (d *Downloader) downloadMirror(ctx context.Context, mirror, destination, fullFileName string, digest Digest,
+	report *MirrorReport, t *progressTracker) (http.Header, error) {
+	d.adoptResumeState(ctx, fullFileName+partSuffix, mirror, digest)
+
+	var served *MirrorRange
+	start := func(offset, length int64) {
+		report.clip(offset)
+		served = &MirrorRange{URL: mirror, Start: offset, End: offset}
+		t.start(offset, length)
+	}
+	progress := func(n int64) {
+		atomic.AddInt64(&served.End, n)
+		t.add(n)
+	}
+
+	header, err := d.download(ctx, mirror, destination, filepath.Base(fullFileName), digest, nil, start, progress)
+	if served != nil && served.End > served.Start {
+		report.Ranges = append(report.Ranges, *served)
+	}
+
+	return header, err
+}
+
+// adoptResumeState hands a partial file downloaded from another mirror over to this one
+// if it serves the same file: the strong ETag or Last-Modified and the length match,
+// or just the length when the expected digest is known. The partial file is restarted otherwise
+func (d *Downloader) adoptResumeState(ctx context.Context, part, mirror string, digest Digest) {
+	s := readResumeState(part)
+	if s == nil || s.URL == redactURL(mirror) {
+		return
+	}
+
+	info, err := d.RemoteInfo(ctx, mirror)
+	if err != nil || !info.AcceptRanges || info.Length <= 0 || info.Length != s.Length {
+		return
+	}
+
+	strong := func(etag string) bool {
+		return etag != "" && !strings.HasPrefix(etag, "W/")
+	}
+	same := !digest.IsZero() ||
+		(strong(s.ETag) && s.ETag == info.ETag) ||
+		(s.LastModified != "" && s.LastModified == info.LastModified)
+	if !same {
+		log.Debug("Mirror ", redactURL(mirror), " serves a different file, restarting download")
+		return
+	}
+
+	adopted := &resumeState{URL: redactURL(mirror), ETag: info.ETag, LastModified: info.LastModified, Length: info.Length}
+	if adopted.validator() == "" {
+		return
+	}
+	if err := adopted.save(part); err != nil {
+		log.Debug("Unable to save resume state of ", part, ": ", err.Error())
+		return
+	}
+	log.Debug("Resuming download of ", part, " from mirror ", redactURL(mirror))
+}
+
+// orderMirrors returns the mirrors starting from the first healthy or the fastest one,
+// mirrors which don't respond are kept at the end as they may recover
+func (d *Downloader) orderMirrors(ctx context.Context, mirrors []string, order MirrorOrder) []string {
+	if order == MirrorsFastest {
+		return d.fastestMirrors(ctx, mirrors)
+	}
+
+	for i, m := range mirrors {
+		if _, err := d.RemoteInfo(ctx, m); err == nil {
+			return append(append([]string{}, mirrors[i:]...), mirrors[:i]...)
+		} else if ctx.Err() != nil {
+			break
+		}
+		log.Debug("Mirror ", redactURL(m), " is unavailable")
+	}
+
+	return mirrors
+}
+
+// fastestMirrors sorts the mirrors by the response time of a HEAD request
+func (d *Downloader) fastestMirrors(ctx context.Context, mirrors []string) []string {
+	type probe struct {
+		url     string
+		latency time.Duration
+		healthy bool
+	}
+
+	probes := make([]probe, len(mirrors))
+	var wg sync.WaitGroup
+	for i, m := range mirrors {
+		wg.Add(1)
+		go func(i int, m string) {
+			defer wg.Done()
+
+			started := time.Now()
+			_, err := d.RemoteInfo(ctx, m)
+			probes[i] = probe{url: m, latency: time.Since(started), healthy: err == nil}
+		}(i, m)
+	}
+	wg.Wait()
+
+	sort.SliceStable(probes, func(i, j int) bool {
+		if probes[i].healthy != probes[j].healthy {
+			return probes[i].healthy
+		}
+		return probes[i].healthy && probes[i].latency < probes[j].latency
+	})
+
+	ordered := make([]string, len(probes))
+	for i, p := range probes {
+		log.Debug("Mirror ", redactURL(p.url), " healthy: ", p.healthy, " latency: ", p.latency)
+		ordered[i] = p.url
+	}
+
+	return ordered
+}
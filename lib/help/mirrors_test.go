@@ -0,0 +1,110 @@
+package help
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDownloadMirrorsFailover(t *testing.T) {
+	content := bytes.Repeat([]byte("nanopi"), 10000)
+	half := len(content) / 2
+
+	// the broken mirror drops the connection in the middle of the file
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		if r.Method == http.MethodHead {
+			return
+		}
+		w.Write(content[:half])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}))
+	defer broken.Close()
+
+	var ranges []string
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			ranges = append(ranges, r.Header.Get("Range"))
+		}
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "board.img", time.Time{}, bytes.NewReader(content))
+	}))
+	defer good.Close()
+
+	dir, err := ioutil.TempDir("", "mirrors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := NewDownloader()
+	d.Quiet = true
+	report, err := d.DownloadMirrors(context.Background(), []string{broken.URL + "/board.img", good.URL + "/board.img"}, dir, MirrorsInOrder)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, report.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, content) {
+		t.Error("Downloaded content differs")
+	}
+
+	want := []MirrorRange{
+		{URL: broken.URL + "/board.img", Start: 0, End: int64(half)},
+		{URL: good.URL + "/board.img", Start: int64(half), End: int64(len(content))},
+	}
+	if len(report.Ranges) != len(want) {
+		t.Fatalf("DownloadMirrors() ranges = %v, want %v", report.Ranges, want)
+	}
+	for i := range want {
+		if report.Ranges[i] != want[i] {
+			t.Errorf("DownloadMirrors() range %d = %v, want %v", i, report.Ranges[i], want[i])
+		}
+	}
+	if len(ranges) != 1 || ranges[0] != "bytes="+strconv.Itoa(half)+"-" {
+		t.Errorf("Second mirror got ranges %q, want resume from %d", ranges, half)
+	}
+}
+
+func TestDownloadMirrorsFastest(t *testing.T) {
+	content := []byte("tinker board image")
+	handler := func(delay time.Duration) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(delay)
+			http.ServeContent(w, r, "tinker.img", time.Time{}, bytes.NewReader(content))
+		})
+	}
+	slow := httptest.NewServer(handler(200 * time.Millisecond))
+	defer slow.Close()
+	fast := httptest.NewServer(handler(0))
+	defer fast.Close()
+
+	dir, err := ioutil.TempDir("", "mirrors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := NewDownloader()
+	d.Quiet = true
+	report, err := d.DownloadMirrors(context.Background(), []string{slow.URL + "/tinker.img", fast.URL + "/tinker.img"}, dir, MirrorsFastest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Ranges) != 1 || report.Ranges[0].URL != fast.URL+"/tinker.img" {
+		t.Errorf("DownloadMirrors() ranges = %v, want all from %s", report.Ranges, fast.URL)
+	}
+}
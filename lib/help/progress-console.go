@@ -0,0 +1,162 @@
+package help
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/tj/go-spin"
+	pb "gopkg.in/cheggaaa/pb.v1"
+)
+
+// ConsoleReporter prints download messages and renders a progress bar on the terminal
+type ConsoleReporter struct {
+	bar *pb.ProgressBar
+}
+
+// NewConsoleReporter returns the default reporter of downloads
+func NewConsoleReporter() *ConsoleReporter {
+	return &ConsoleReporter{}
+}
+
+// Report implements ProgressReporter
+func (c *ConsoleReporter) Report(e ProgressEvent) {
+	switch e.Type {
+	case ProgressStarted:
+		fmt.Printf("[+] Downloading %s from %s to %s\n", filepath.Base(e.File), redactURL(e.URL), filepath.Dir(e.File))
+		c.bar = pb.New64(e.Total)
+		c.bar.ShowBar = false
+		c.bar.SetUnits(pb.U_BYTES)
+		c.bar.SetWidth(100)
+		c.bar.Set64(e.Offset)
+		c.bar.Start()
+	case ProgressBytes:
+		if c.bar != nil {
+			c.bar.Add64(e.N)
+		}
+	case ProgressRetried:
+		c.finishBar()
+		fmt.Printf("[-] Attempt %d failed: %s. Retrying in %s\n", e.Attempt, e.Err.Error(), e.Delay.Round(time.Second))
+	case ProgressFinished:
+		c.finishBar()
+		if e.Cached {
+			fmt.Printf("[+] File exist %s\n", e.File)
+		} else {
+			fmt.Printf("\n[+] Done\n")
+		}
+	case ProgressFailed:
+		c.finishBar()
+		fmt.Printf("[-] Could not download from url:%s \n", redactURL(e.URL))
+		fmt.Printf("[-] Reported error message:%s\n", e.Err.Error())
+	}
+}
+
+func (c *ConsoleReporter) finishBar() {
+	if c.bar != nil {
+		c.bar.Finish()
+		c.bar = nil
+	}
+}
+
+// SpinnerReporter renders a single line with a spinner, the rate and ETA,
+// for terminals where a progress bar doesn't fit
+type SpinnerReporter struct {
+	spinner *spin.Spinner
+	last    time.Time
+}
+
+// NewSpinnerReporter returns a spinner reporter
+func NewSpinnerReporter() *SpinnerReporter {
+	s := spin.New()
+	s.Set(spin.Spin1)
+	return &SpinnerReporter{spinner: s}
+}
+
+// Report implements ProgressReporter
+func (s *SpinnerReporter) Report(e ProgressEvent) {
+	name := filepath.Base(e.File)
+	switch e.Type {
+	case ProgressBytes:
+		// redraw at most ten times a second
+		if time.Since(s.last) < 100*time.Millisecond {
+			return
+		}
+		s.last = time.Now()
+		fmt.Printf("\r[+] Downloading %s: %s %s %s/s ETA %s ", name, s.spinner.Next(),
+			pb.Format(e.Done).To(pb.U_BYTES), pb.Format(int64(e.Rate)).To(pb.U_BYTES), e.ETA.Round(time.Second))
+	case ProgressRetried:
+		fmt.Printf("\n[-] Attempt %d failed: %s. Retrying in %s\n", e.Attempt, e.Err.Error(), e.Delay.Round(time.Second))
+	case ProgressFinished:
+		fmt.Printf("\r[+] Downloading %s: done\n", name)
+	case ProgressFailed:
+		fmt.Printf("\n[-] Could not download %s: %s\n", name, e.Err.Error())
+	}
+}
+
+// ConsoleBatchReporter renders a progress bar of every artifact and the total of a batch,
+// it prints a line per artifact when the terminal doesn't support multiple bars
+type ConsoleBatchReporter struct {
+	pool  *pb.Pool
+	total *pb.ProgressBar
+	bars  map[int]*pb.ProgressBar
+	lines bool
+}
+
+// NewConsoleBatchReporter returns the default reporter of batches
+func NewConsoleBatchReporter() *ConsoleBatchReporter {
+	return &ConsoleBatchReporter{bars: make(map[int]*pb.ProgressBar)}
+}
+
+// ReportBatch implements BatchReporter
+func (c *ConsoleBatchReporter) ReportBatch(e BatchEvent) {
+	if c.pool == nil && !c.lines {
+		c.total = pb.New64(0).Prefix("Total ")
+		c.total.SetUnits(pb.U_BYTES)
+		if pool, err := pb.StartPool(c.total); err == nil {
+			c.pool = pool
+		} else {
+			c.lines = true
+		}
+	}
+
+	name := filepath.Base(e.File)
+	switch e.Type {
+	case ProgressStarted:
+		if c.lines {
+			fmt.Printf("[+] Downloading %s from %s\n", name, redactURL(e.URL))
+			break
+		}
+		bar := pb.New64(e.Total).Prefix(name + " ")
+		bar.SetUnits(pb.U_BYTES)
+		bar.Set64(e.Offset)
+		c.bars[e.Item] = bar
+		c.pool.Add(bar)
+	case ProgressBytes:
+		if bar, ok := c.bars[e.Item]; ok {
+			bar.Add64(e.N)
+		}
+	case ProgressFinished:
+		if c.lines {
+			fmt.Printf("[+] Downloaded %s (%d of %d)\n", e.File, e.Finished, e.Count)
+		} else if bar, ok := c.bars[e.Item]; ok {
+			bar.Set64(bar.Total)
+		}
+	case ProgressFailed:
+		if c.lines {
+			fmt.Printf("[-] Could not download %s: %s\n", redactURL(e.URL), e.Err.Error())
+		} else if bar, ok := c.bars[e.Item]; ok {
+			bar.Prefix("[-] " + name + " ")
+		}
+	}
+
+	if c.total != nil {
+		c.total.Total = e.BatchTotal
+		c.total.Set64(e.BatchDone)
+	}
+	if e.Finished+e.Failed == e.Count {
+		if c.pool != nil {
+			c.pool.Stop()
+		}
+		fmt.Printf("[+] Downloaded %d of %d files\n", e.Finished, e.Count)
+	}
+}
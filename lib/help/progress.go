@@ -0,0 +1,170 @@
+package help
+
+import (
+	"sync"
+	"time"
+)
+
+// ProgressEventType is the kind of a progress event
+type ProgressEventType int
+
+const (
+	// ProgressStarted is sent when the transfer begins, Offset bytes are already downloaded
+	ProgressStarted ProgressEventType = iota
+	// ProgressBytes is sent for every N bytes received
+	ProgressBytes
+	// ProgressRetried is sent when an attempt failed with Err and the next one starts after Delay
+	ProgressRetried
+	// ProgressFinished is sent once the file is downloaded and verified
+	ProgressFinished
+	// ProgressFailed is sent when the download gives up with Err
+	ProgressFailed
+)
+
+// ProgressEvent describes the state of a download
+type ProgressEvent struct {
+	Type ProgressEventType
+	URL  string
+	// File is the destination path
+	File string
+	// Offset is the number of bytes downloaded before the transfer started
+	Offset int64
+	// Done is the number of bytes downloaded so far including the Offset
+	Done int64
+	// Total is the length of the file, -1 if unknown
+	Total int64
+	// N is the number of bytes received with the ProgressBytes event
+	N int64
+	// Decompressed is the number of bytes written by a streaming download so far
+	Decompressed int64
+	// Rate is the average speed of the transfer in bytes per second
+	Rate float64
+	// ETA is the estimated time left, zero if unknown
+	ETA     time.Duration
+	Attempt int
+	Delay   time.Duration
+	// Cached is set when the download finished without a transfer,
+	// the file already existed or was taken from the cache
+	Cached bool
+	Err    error
+}
+
+// ProgressReporter receives progress events of downloads, events of a single download
+// are delivered one at a time
+type ProgressReporter interface {
+	Report(e ProgressEvent)
+}
+
+// ProgressFunc is a function used as a ProgressReporter
+type ProgressFunc func(e ProgressEvent)
+
+// Report implements ProgressReporter
+func (f ProgressFunc) Report(e ProgressEvent) {
+	f(e)
+}
+
+// progressTracker turns transfer callbacks into events, computing rate and ETA
+type progressTracker struct {
+	reporter ProgressReporter
+	url      string
+	file     string
+
+	mu           sync.Mutex
+	started      time.Time
+	offset       int64
+	done         int64
+	total        int64
+	decompressed int64
+}
+
+// track returns the tracker of the download into the file, the console is used
+// when no reporter is set unless the downloader is quiet
+func (d *Downloader) track(rawurl, file string) *progressTracker {
+	reporter := d.Progress
+	if reporter == nil && !d.Quiet {
+		reporter = NewConsoleReporter()
+	}
+	return &progressTracker{reporter: reporter, url: rawurl, file: file, total: -1}
+}
+
+func (t *progressTracker) event(typ ProgressEventType) ProgressEvent {
+	e := ProgressEvent{
+		Type:         typ,
+		URL:          t.url,
+		File:         t.file,
+		Offset:       t.offset,
+		Done:         t.done,
+		Total:        t.total,
+		Decompressed: t.decompressed,
+	}
+
+	if elapsed := time.Since(t.started).Seconds(); !t.started.IsZero() && elapsed > 0 {
+		e.Rate = float64(t.done-t.offset) / elapsed
+	}
+	if e.Rate > 0 && t.total > t.done {
+		e.ETA = time.Duration(float64(t.total-t.done) / e.Rate * float64(time.Second))
+	}
+
+	return e
+}
+
+func (t *progressTracker) report(e ProgressEvent) {
+	if t.reporter != nil {
+		t.reporter.Report(e)
+	}
+}
+
+func (t *progressTracker) start(offset, length int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.started = time.Now()
+	t.offset, t.done, t.total = offset, offset, length
+	t.report(t.event(ProgressStarted))
+}
+
+// add may be called concurrently by segments
+func (t *progressTracker) add(n int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.done += n
+	e := t.event(ProgressBytes)
+	e.N = n
+	t.report(e)
+}
+
+// decompress counts written bytes, they are reported with the next event
+func (t *progressTracker) decompress(n int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.decompressed += n
+}
+
+func (t *progressTracker) retry(attempt int, delay time.Duration, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e := t.event(ProgressRetried)
+	e.Attempt, e.Delay, e.Err = attempt, delay, err
+	t.report(e)
+}
+
+func (t *progressTracker) finish(cached bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e := t.event(ProgressFinished)
+	e.Cached = cached
+	t.report(e)
+}
+
+func (t *progressTracker) fail(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e := t.event(ProgressFailed)
+	e.Err = err
+	t.report(e)
+}
@@ -0,0 +1,74 @@
+package help
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDownloaderProgressEvents(t *testing.T) {
+	content := bytes.Repeat([]byte("progress"), 4096)
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		http.ServeContent(w, r, "events.img", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "progress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var events []ProgressEvent
+	d := NewDownloader()
+	d.RetryPolicy = &Backoff{MaxAttempts: 2, InitialDelay: time.Millisecond}
+	d.Progress = ProgressFunc(func(e ProgressEvent) {
+		events = append(events, e)
+	})
+	if _, err := d.Download(context.Background(), srv.URL+"/events.img", dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) < 4 {
+		t.Fatalf("Download() sent %d events, want at least 4", len(events))
+	}
+	if e := events[0]; e.Type != ProgressRetried || e.Attempt != 1 || e.Err == nil {
+		t.Errorf("First event = %+v, want retry of the attempt 1", e)
+	}
+	if e := events[1]; e.Type != ProgressStarted || e.Total != int64(len(content)) {
+		t.Errorf("Second event = %+v, want start of %d bytes", e, len(content))
+	}
+	var received int64
+	for _, e := range events[2 : len(events)-1] {
+		if e.Type != ProgressBytes {
+			t.Errorf("Event type = %d, want ProgressBytes", e.Type)
+		}
+		received += e.N
+	}
+	if received != int64(len(content)) {
+		t.Errorf("Received bytes = %d, want %d", received, len(content))
+	}
+	if e := events[len(events)-1]; e.Type != ProgressFinished || e.Done != int64(len(content)) || e.Cached {
+		t.Errorf("Last event = %+v, want finish of the transfer", e)
+	}
+
+	// the second download reuses the file
+	events = nil
+	if _, err := d.Download(context.Background(), srv.URL+"/events.img", dir); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Type != ProgressFinished || !events[0].Cached {
+		t.Errorf("Download() of an existing file sent %+v, want a cached finish", events)
+	}
+}
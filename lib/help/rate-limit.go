@@ -0,0 +1,121 @@
+package help
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// minRateChunk is the smallest amount of bytes transferred at once through a rate limiter
+const minRateChunk = 1024
+
+// RateLimiter is a token bucket of bytes per second, one limiter may be shared
+// by concurrent transfers to cap their total throughput
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a limiter of bytesPerSecond, zero or negative rate means unlimited
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	return &RateLimiter{rate: float64(bytesPerSecond), last: time.Now()}
+}
+
+// SetRate changes the limit of all the transfers sharing the limiter
+func (l *RateLimiter) SetRate(bytesPerSecond int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rate = float64(bytesPerSecond)
+	l.tokens = 0
+	l.last = time.Now()
+}
+
+// chunk returns the size of a single read or write, so a transfer doesn't sleep for too long at once
+func (l *RateLimiter) chunk() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if c := int(l.rate / 10); c > minRateChunk {
+		return c
+	}
+	return minRateChunk
+}
+
+// Wait takes n bytes from the bucket sleeping until they are available,
+// at most a second worth of unused bandwidth is accumulated
+func (l *RateLimiter) Wait(n int) {
+	l.mu.Lock()
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	time.Sleep(delay)
+}
+
+// chunkReader limits the size of every read to the chunk of the limiter
+type chunkReader struct {
+	io.Reader
+	limiter *RateLimiter
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if c := r.limiter.chunk(); len(p) > c {
+		p = p[:c]
+	}
+	return r.Reader.Read(p)
+}
+
+// NewRateLimitedReader returns a reader throttled by the limiter
+func NewRateLimitedReader(r io.Reader, limiter *RateLimiter) io.Reader {
+	return NewHttpProxyReader(&chunkReader{r, limiter}, func(n int, _ error) {
+		limiter.Wait(n)
+	})
+}
+
+type rateLimitedWriter struct {
+	io.Writer
+	limiter *RateLimiter
+}
+
+// NewRateLimitedWriter returns a writer throttled by the limiter
+func NewRateLimitedWriter(w io.Writer, limiter *RateLimiter) io.Writer {
+	return &rateLimitedWriter{w, limiter}
+}
+
+func (w *rateLimitedWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		c := w.limiter.chunk()
+		if c > len(p) {
+			c = len(p)
+		}
+
+		var written int
+		written, err = w.Writer.Write(p[:c])
+		n += written
+		w.limiter.Wait(written)
+		if err != nil {
+			return
+		}
+		p = p[c:]
+	}
+
+	return
+}
@@ -0,0 +1,31 @@
+package help
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterShared(t *testing.T) {
+	limiter := NewRateLimiter(100 * 1024)
+	started := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := NewRateLimitedReader(bytes.NewReader(make([]byte, 10*1024)), limiter)
+			io.Copy(ioutil.Discard, r)
+		}()
+	}
+	wg.Wait()
+
+	// 20 KiB through a shared 100 KiB/s budget
+	if elapsed := time.Since(started); elapsed < 150*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Transfer took %s, want about 200ms", elapsed)
+	}
+}
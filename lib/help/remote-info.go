@@ -0,0 +1,103 @@
+package help
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RemoteFileInfo describes a remote file without downloading it
+type RemoteFileInfo struct {
+	// URL is the final url after redirects
+	URL string
+	// Length is the size of the file, -1 if unknown
+	Length       int64
+	ContentType  string
+	FileName     string
+	ETag         string
+	LastModified string
+	AcceptRanges bool
+}
+
+// RemoteInfo returns metadata of the remote file using a HEAD request,
+// falls back to a GET of the first byte for servers which don't support HEAD
+func RemoteInfo(url string) (*RemoteFileInfo, error) {
+	return NewDownloader().RemoteInfo(context.Background(), url)
+}
+
+// RemoteInfo returns metadata of the remote file using a HEAD request,
+// falls back to a GET of the first byte for servers which don't support HEAD.
+// Other sources are asked with Stat
+func (d *Downloader) RemoteInfo(ctx context.Context, rawurl string) (*RemoteFileInfo, error) {
+	if !isHTTP(rawurl) {
+		src, err := d.Source(rawurl)
+		if err != nil {
+			return nil, err
+		}
+		return src.Stat(ctx)
+	}
+
+	resp, err := d.request(ctx, http.MethodHead, rawurl, nil)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			return newRemoteFileInfo(rawurl, resp), nil
+		}
+		log.Debug("HEAD ", redactURL(rawurl), " responded with ", resp.Status, ", falling back to GET")
+	} else if ctx.Err() != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	header.Set("Range", "bytes=0-0")
+	resp, err = d.request(ctx, http.MethodGet, rawurl, header)
+	if err != nil {
+		return nil, err
+	}
+	// the body is not needed, closing it aborts the transfer of the full file
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return nil, newHTTPStatusError(resp)
+	}
+
+	return newRemoteFileInfo(rawurl, resp), nil
+}
+
+func newRemoteFileInfo(rawurl string, resp *http.Response) *RemoteFileInfo {
+	info := &RemoteFileInfo{
+		URL:          resp.Request.URL.String(),
+		Length:       resp.ContentLength,
+		ContentType:  resp.Header.Get("Content-Type"),
+		FileName:     fileNameFromResponse(rawurl, resp),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		AcceptRanges: resp.Header.Get("Accept-Ranges") == "bytes",
+	}
+
+	if resp.StatusCode == http.StatusPartialContent {
+		info.AcceptRanges = true
+		info.Length = contentRangeTotal(resp.Header.Get("Content-Range"))
+	}
+
+	return info
+}
+
+// contentRangeTotal parses the complete length of the `bytes start-end/total` and `bytes */total`
+// headers, -1 if unknown
+func contentRangeTotal(contentRange string) int64 {
+	i := strings.LastIndex(contentRange, "/")
+	if i < 0 {
+		return -1
+	}
+
+	total, err := strconv.ParseInt(contentRange[i+1:], 10, 64)
+	if err != nil {
+		return -1
+	}
+
+	return total
+}
@@ -0,0 +1,46 @@
+package help
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRemoteInfo(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/latest", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/files/raspbian.zip", http.StatusFound)
+	})
+	mux.HandleFunc("/files/raspbian.zip", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead && r.URL.Query().Get("head") == "" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("ETag", `"abc"`)
+		w.Header().Set("Content-Disposition", `attachment; filename="raspbian-lite.zip"`)
+		http.ServeContent(w, r, "raspbian.zip", time.Time{}, strings.NewReader(strings.Repeat("x", 1000)))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{"head", srv.URL + "/files/raspbian.zip?head=1"},
+		{"ranged-get", srv.URL + "/latest"},
+	}
+	for _, tt := range tests {
+		info, err := RemoteInfo(tt.url)
+		if err != nil {
+			t.Errorf("%q. RemoteInfo() error = %v", tt.name, err)
+			continue
+		}
+		if info.Length != 1000 || !info.AcceptRanges || info.ETag != `"abc"` ||
+			info.FileName != "raspbian-lite.zip" || !strings.Contains(info.URL, "/files/raspbian.zip") {
+			t.Errorf("%q. RemoteInfo() = %+v", tt.name, info)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package help
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy decides whether and when a failed download is retried
+type RetryPolicy interface {
+	// Next is called after the failed attempt (starting from 1), it returns the delay before
+	// the next attempt or false to give up
+	Next(attempt int, elapsed time.Duration, err error) (time.Duration, bool)
+}
+
+// Backoff is a RetryPolicy with exponentially growing delays randomized by jitter
+type Backoff struct {
+	// MaxAttempts limits the number of attempts, zero means unlimited
+	MaxAttempts int
+	// MaxElapsed limits the time since the first attempt, zero means unlimited
+	MaxElapsed   time.Duration
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64
+	// Jitter is the fraction of the delay which is randomized, from 0 to 1
+	Jitter float64
+	// Retryable classifies errors, IsRetryable is used when it's nil
+	Retryable func(error) bool
+}
+
+// NewBackoff returns a policy making up to the given number of attempts with delays
+// starting from a second and doubling up to a minute
+func NewBackoff(attempts int) *Backoff {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return &Backoff{
+		MaxAttempts:  attempts,
+		InitialDelay: time.Second,
+		MaxDelay:     time.Minute,
+		Multiplier:   2,
+		Jitter:       0.2,
+	}
+}
+
+// Next implements RetryPolicy
+func (b *Backoff) Next(attempt int, elapsed time.Duration, err error) (time.Duration, bool) {
+	retryable := b.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+	if !retryable(err) || (b.MaxAttempts > 0 && attempt >= b.MaxAttempts) {
+		return 0, false
+	}
+
+	delay := float64(b.InitialDelay)
+	for i := 1; i < attempt; i++ {
+		delay *= b.Multiplier
+		if b.MaxDelay > 0 && delay > float64(b.MaxDelay) {
+			break
+		}
+	}
+	if b.MaxDelay > 0 && delay > float64(b.MaxDelay) {
+		delay = float64(b.MaxDelay)
+	}
+	if b.Jitter > 0 {
+		delay += delay * b.Jitter * (2*rand.Float64() - 1)
+	}
+
+	if b.MaxElapsed > 0 && elapsed+time.Duration(delay) > b.MaxElapsed {
+		return 0, false
+	}
+
+	return time.Duration(delay), true
+}
+
+// HTTPStatusError is returned when a server responds with an unexpected status
+type HTTPStatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("%s %s: unexpected http status %s", e.Method, e.URL, e.Status)
+}
+
+func newHTTPStatusError(resp *http.Response) error {
+	return &HTTPStatusError{
+		Method:     resp.Request.Method,
+		URL:        redactURL(resp.Request.URL.String()),
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+	}
+}
+
+// IsRetryable returns true for transient errors: timeouts, stalled and interrupted transfers,
+// connection resets and refusals, 5xx, 408 and 429 responses
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 ||
+			statusErr.StatusCode == http.StatusRequestTimeout ||
+			statusErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, ErrStalled) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ENETUNREACH) ||
+		errors.Is(err, syscall.EHOSTUNREACH)
+}
+
+// sleep waits for the delay or the context cancellation
+func sleep(ctx context.Context, delay time.Duration) error {
+	t := time.NewTimer(delay)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
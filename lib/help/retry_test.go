@@ -0,0 +1,96 @@
+package help
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"503", &HTTPStatusError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"429", &HTTPStatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{"404", &HTTPStatusError{StatusCode: http.StatusNotFound}, false},
+		{"unexpected-eof", io.ErrUnexpectedEOF, true},
+		{"canceled", context.Canceled, false},
+		{"checksum", &ChecksumError{}, false},
+		{"other", errors.New("other"), false},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("%q. IsRetryable() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBackoffNext(t *testing.T) {
+	b := &Backoff{MaxAttempts: 5, InitialDelay: time.Second, MaxDelay: 3 * time.Second, Multiplier: 2, MaxElapsed: 10 * time.Second}
+	err := io.ErrUnexpectedEOF
+
+	tests := []struct {
+		attempt   int
+		elapsed   time.Duration
+		wantDelay time.Duration
+		wantRetry bool
+	}{
+		{1, 0, time.Second, true},
+		{2, 0, 2 * time.Second, true},
+		{3, 0, 3 * time.Second, true},
+		{3, 8 * time.Second, 0, false},
+		{5, 0, 0, false},
+	}
+	for _, tt := range tests {
+		delay, retry := b.Next(tt.attempt, tt.elapsed, err)
+		if delay != tt.wantDelay || retry != tt.wantRetry {
+			t.Errorf("Next(%d, %s) = %s, %v, want %s, %v", tt.attempt, tt.elapsed, delay, retry, tt.wantDelay, tt.wantRetry)
+		}
+	}
+}
+
+func TestDownloaderRetry(t *testing.T) {
+	var requests int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/flaky.img", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= 2 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("image"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "retry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := NewDownloader()
+	d.Quiet = true
+	d.RetryPolicy = &Backoff{MaxAttempts: 3, InitialDelay: time.Millisecond, Multiplier: 2}
+	if _, err := d.Download(context.Background(), srv.URL+"/flaky.img", dir); err != nil {
+		t.Errorf("Download() error = %v", err)
+	}
+
+	started := time.Now()
+	d.RetryPolicy = &Backoff{MaxAttempts: 3, InitialDelay: time.Second}
+	_, err = d.Download(context.Background(), srv.URL+"/missing.img", dir)
+	if statusErr, ok := err.(*HTTPStatusError); !ok || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Download() error = %v, want 404 *HTTPStatusError", err)
+	}
+	if time.Since(started) > 500*time.Millisecond {
+		t.Error("Permanent errors should not be retried")
+	}
+}
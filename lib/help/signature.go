@@ -0,0 +1,171 @@
+package help
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// ErrSignature is returned when a detached signature doesn't match the file
+var ErrSignature = errors.New("signature verification failed")
+
+// ErrSignedTooLarge is returned for signatures of the whole message when the file is larger
+// than maxSignedSize, such files need prehashed signatures like the ones of minisign -H
+var ErrSignedTooLarge = errors.New("file is too large for a signature which isn't prehashed")
+
+// maxSignedSize caps files verified with signatures of the whole message, which is held in memory
+var maxSignedSize int64 = 64 * 1024 * 1024
+
+// SignatureVerifier verifies a detached signature of a file, a signature which doesn't match
+// is reported with ErrSignature and only then the file is rejected
+type SignatureVerifier interface {
+	Verify(file string, signature []byte) error
+}
+
+type ed25519Verifier struct {
+	key ed25519.PublicKey
+}
+
+// NewEd25519Verifier returns a verifier of raw or base64 encoded ed25519 signatures,
+// files larger than 64MB are rejected with ErrSignedTooLarge
+func NewEd25519Verifier(publicKey ed25519.PublicKey) (SignatureVerifier, error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid ed25519 public key length")
+	}
+	return &ed25519Verifier{publicKey}, nil
+}
+
+func (v *ed25519Verifier) Verify(file string, signature []byte) error {
+	if len(signature) != ed25519.SignatureSize {
+		sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+		if err != nil {
+			return ErrSignature
+		}
+		signature = sig
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	message, err := readSigned(f)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(v.key, message, signature) {
+		return ErrSignature
+	}
+
+	return nil
+}
+
+// readSigned reads the message of a signature which isn't prehashed, up to maxSignedSize
+func readSigned(r io.Reader) ([]byte, error) {
+	message, err := ioutil.ReadAll(io.LimitReader(r, maxSignedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(message)) > maxSignedSize {
+		return nil, ErrSignedTooLarge
+	}
+	return message, nil
+}
+
+// minisign key and signature layout: 2 bytes algorithm, 8 bytes key id and the key or signature
+const (
+	minisignAlgLen = 2
+	minisignIDLen  = 8
+)
+
+type minisignVerifier struct {
+	id  []byte
+	key ed25519.PublicKey
+}
+
+// NewMinisignVerifier returns a verifier of minisign signatures, the public key is
+// the base64 line of a minisign.pub file. Prehashed signatures are streamed, legacy ones
+// are rejected with ErrSignedTooLarge for files larger than 64MB
+func NewMinisignVerifier(publicKey string) (SignatureVerifier, error) {
+	lines := strings.Split(strings.TrimSpace(publicKey), "\n")
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[len(lines)-1]))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != minisignAlgLen+minisignIDLen+ed25519.PublicKeySize || string(raw[:minisignAlgLen]) != "Ed" {
+		return nil, errors.New("invalid minisign public key")
+	}
+
+	return &minisignVerifier{
+		id:  raw[minisignAlgLen : minisignAlgLen+minisignIDLen],
+		key: ed25519.PublicKey(raw[minisignAlgLen+minisignIDLen:]),
+	}, nil
+}
+
+func (v *minisignVerifier) Verify(file string, signature []byte) error {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(signature))
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimSpace(scanner.Text()))
+	}
+	if len(lines) < 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return errors.New("invalid minisign signature format")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(sig) != minisignAlgLen+minisignIDLen+ed25519.SignatureSize {
+		return errors.New("invalid minisign signature")
+	}
+	globalSig, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return errors.New("invalid minisign global signature")
+	}
+
+	alg, id, sig := string(sig[:minisignAlgLen]), sig[minisignAlgLen:minisignAlgLen+minisignIDLen], sig[minisignAlgLen+minisignIDLen:]
+	if !bytes.Equal(id, v.id) {
+		return errors.New("minisign signature was made with a different key")
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var message []byte
+	switch alg {
+	case "Ed":
+		if message, err = readSigned(f); err != nil {
+			return err
+		}
+	case "ED":
+		// prehashed signature
+		h, _ := blake2b.New512(nil)
+		if _, err := io.Copy(h, f); err != nil {
+			return err
+		}
+		message = h.Sum(nil)
+	default:
+		return errors.New("unsupported minisign signature algorithm")
+	}
+
+	if !ed25519.Verify(v.key, message, sig) {
+		return ErrSignature
+	}
+
+	trusted := strings.TrimPrefix(lines[2], "trusted comment: ")
+	if !ed25519.Verify(v.key, append(append([]byte{}, sig...), trusted...), globalSig) {
+		return ErrSignature
+	}
+
+	return nil
+}
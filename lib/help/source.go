@@ -0,0 +1,318 @@
+package help
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxFetchSize caps the files read into memory by Fetch
+const maxFetchSize = 16 * 1024 * 1024
+
+// ErrFetchTooLarge is returned by Fetch for files larger than 16MB
+var ErrFetchTooLarge = errors.New("file is too large to fetch into memory")
+
+// Source is a file an artifact is downloaded from
+type Source interface {
+	// Open returns the content of the whole file
+	Open(ctx context.Context) (io.ReadCloser, error)
+	// Stat returns metadata of the file, LastModified identifies its version
+	Stat(ctx context.Context) (*RemoteFileInfo, error)
+}
+
+// RangeSource is a Source able to read from an offset, it's used to resume downloads
+type RangeSource interface {
+	Source
+	// OpenRange returns length bytes from the offset, or the rest of the file if length is negative
+	OpenRange(ctx context.Context, offset, length int64) (io.ReadCloser, error)
+}
+
+// SourceFactory returns the source of the url for the downloader
+type SourceFactory func(d *Downloader, u *url.URL) (Source, error)
+
+var (
+	sourcesMu sync.RWMutex
+	sources   = map[string]SourceFactory{
+		"http":  newHTTPSource,
+		"https": newHTTPSource,
+		"file":  newFileSource,
+	}
+)
+
+// RegisterSource makes urls of the scheme downloadable. The sftp scheme is registered by lib/ssh_helper
+func RegisterSource(scheme string, factory SourceFactory) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+
+	sources[strings.ToLower(scheme)] = factory
+}
+
+// Source returns the source of the url according to its scheme
+func (d *Downloader) Source(rawurl string) (Source, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	sourcesMu.RLock()
+	factory, ok := sources[strings.ToLower(u.Scheme)]
+	sourcesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported url scheme %q", u.Scheme)
+	}
+
+	return factory(d, u)
+}
+
+// Fetch reads a small file such as a release feed or an image catalog into memory as it's served,
+// it isn't decompressed. The client, credentials and rate limiter of the downloader are used,
+// files larger than maxFetchSize are rejected with ErrFetchTooLarge
+func (d *Downloader) Fetch(ctx context.Context, rawurl string) ([]byte, error) {
+	src, err := d.Source(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := src.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(d.limit(rc), maxFetchSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxFetchSize {
+		return nil, fmt.Errorf("%s: %w", redactURL(rawurl), ErrFetchTooLarge)
+	}
+	return data, nil
+}
+
+// isHTTP returns true for urls downloaded with the http client directly
+func isHTTP(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return true
+	}
+	scheme := strings.ToLower(u.Scheme)
+	return scheme == "http" || scheme == "https"
+}
+
+// httpSource reads urls with the client and credentials of the downloader
+type httpSource struct {
+	d   *Downloader
+	url string
+}
+
+func newHTTPSource(d *Downloader, u *url.URL) (Source, error) {
+	return &httpSource{d: d, url: u.String()}, nil
+}
+
+func (s *httpSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	return s.OpenRange(ctx, 0, -1)
+}
+
+func (s *httpSource) Stat(ctx context.Context) (*RemoteFileInfo, error) {
+	return s.d.RemoteInfo(ctx, s.url)
+}
+
+func (s *httpSource) OpenRange(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	end := int64(-1)
+	if length >= 0 {
+		end = offset + length - 1
+	}
+	resp, err := s.d.get(ctx, s.url, offset, end)
+	if err != nil {
+		return nil, err
+	}
+	if (offset > 0 || end >= 0) && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: range is not supported", redactURL(s.url))
+	}
+
+	return resp.Body, nil
+}
+
+// fileSource reads local files and mounted drives
+type fileSource struct {
+	url  string
+	path string
+}
+
+func newFileSource(_ *Downloader, u *url.URL) (Source, error) {
+	path := u.Path
+	if u.Host != "" && u.Host != "localhost" {
+		return nil, fmt.Errorf("remote host %q of a file url", u.Host)
+	}
+	return &fileSource{url: u.String(), path: fileURLPath(runtime.GOOS, path)}, nil
+}
+
+// fileURLPath converts the path of a file url to a path of the os,
+// on windows file:///C:/img.zip is C:\img.zip
+func fileURLPath(os, path string) string {
+	if os == "windows" && len(path) > 2 && path[0] == '/' && path[2] == ':' {
+		path = path[1:]
+	}
+	return strings.Replace(path, "/", Separators(os), -1)
+}
+
+func (s *fileSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	return s.OpenRange(ctx, 0, -1)
+}
+
+func (s *fileSource) Stat(ctx context.Context) (*RemoteFileInfo, error) {
+	fi, err := os.Stat(s.path)
+	if err != nil {
+		return nil, err
+	}
+	return NewSourceFileInfo(redactURL(s.url), fi), nil
+}
+
+func (s *fileSource) OpenRange(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	// reads of mounted drives may hang, the context stops them between reads
+	return LimitReadCloser(struct {
+		io.Reader
+		io.Closer
+	}{contextReader(ctx, f), f}, length), nil
+}
+
+// NewSourceFileInfo describes a file of a source by its file info
+func NewSourceFileInfo(rawurl string, fi os.FileInfo) *RemoteFileInfo {
+	return &RemoteFileInfo{
+		URL:          rawurl,
+		Length:       fi.Size(),
+		FileName:     fi.Name(),
+		LastModified: fi.ModTime().UTC().Format(http.TimeFormat),
+		AcceptRanges: true,
+	}
+}
+
+type limitReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// LimitReadCloser reads up to n bytes of the rc, negative n means no limit
+func LimitReadCloser(rc io.ReadCloser, n int64) io.ReadCloser {
+	if n < 0 {
+		return rc
+	}
+	return &limitReadCloser{io.LimitReader(rc, n), rc}
+}
+
+// sourceHeader carries validators of a source file as http headers of the cache and resume state
+func sourceHeader(info *RemoteFileInfo) http.Header {
+	header := http.Header{}
+	if info.ETag != "" {
+		header.Set("ETag", info.ETag)
+	}
+	if info.LastModified != "" {
+		header.Set("Last-Modified", info.LastModified)
+	}
+	return header
+}
+
+// fetchSource downloads a non-http source as fetch does, partial files are resumed
+// when the source supports ranges and the file hasn't changed
+func (d *Downloader) fetchSource(ctx context.Context, rawurl, dst string, digest Digest,
+	start func(offset, length int64), progress func(n int64)) (http.Header, error) {
+
+	src, err := d.Source(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	info, err := src.Stat(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	part := dst + partSuffix
+	var offset int64
+	rs, ranged := src.(RangeSource)
+	if state := loadResumeState(part, rawurl); ranged && state != nil &&
+		state.validator() == info.LastModified && state.Length == info.Length {
+		offset, _ = GetFileLength(part)
+	}
+
+	if info.Length > 0 {
+		if err := CheckSpace(filepath.Dir(dst), info.Length-offset); err != nil {
+			return nil, err
+		}
+	}
+
+	var body io.ReadCloser
+	if offset > 0 {
+		log.Debug("Resuming download of ", redactURL(rawurl), " from ", offset)
+		body, err = rs.OpenRange(ctx, offset, -1)
+	} else {
+		state := &resumeState{URL: redactURL(rawurl), ETag: info.ETag, LastModified: info.LastModified, Length: info.Length}
+		if err := state.save(part); err != nil {
+			log.Debug("Unable to save resume state of ", part, ": ", err.Error())
+		}
+		body, err = src.Open(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	streamed := digest
+	if offset > 0 {
+		flags = os.O_WRONLY | os.O_APPEND
+		streamed = Digest{}
+	}
+	output, err := os.OpenFile(part, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer output.Close()
+
+	start(offset, info.Length)
+
+	var h hash.Hash
+	var n int64
+	if h, n, err = copyHashed(output, d.limit(body), streamed, progress); err != nil {
+		return nil, err
+	}
+	if info.Length > 0 && offset+n != info.Length {
+		return nil, fmt.Errorf("%s: received %d bytes out of %d: %w", redactURL(rawurl), offset+n, info.Length, io.ErrUnexpectedEOF)
+	}
+
+	if err := output.Close(); err != nil {
+		return nil, err
+	}
+	if err := d.verify(ctx, part, digest, h); err != nil {
+		// the complete part is verified again on retries unless it was rejected
+		if isMismatch(err) {
+			removeResumeState(part)
+		}
+		return nil, err
+	}
+	if err := os.Rename(part, dst); err != nil {
+		return nil, err
+	}
+	removeResumeState(part)
+
+	return sourceHeader(info), nil
+}
@@ -0,0 +1,115 @@
+package help
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileURLPath(t *testing.T) {
+	tests := []struct {
+		os   string
+		path string
+		want string
+	}{
+		{"linux", "/home/pi/img.zip", "/home/pi/img.zip"},
+		{"windows", "/C:/Users/pi/img.zip", `C:\Users\pi\img.zip`},
+		{"windows", "/images/img.zip", `\images\img.zip`},
+	}
+	for _, tt := range tests {
+		if got := fileURLPath(tt.os, tt.path); got != tt.want {
+			t.Errorf("%q. fileURLPath() = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := bytes.Repeat([]byte("usb drive image"), 1000)
+	src := filepath.Join(dir, "usb", "tinker.img")
+	CreateDir(filepath.Dir(src))
+	if err := ioutil.WriteFile(src, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	rawurl := "file:///" + strings.TrimPrefix(filepath.ToSlash(src), "/")
+
+	d := NewDownloader()
+	info, err := d.RemoteInfo(context.Background(), rawurl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Length != int64(len(content)) || info.FileName != "tinker.img" || info.LastModified == "" {
+		t.Errorf("RemoteInfo() = %+v", info)
+	}
+
+	// a partial copy of the same file is resumed
+	dst := filepath.Join(dir, "dst")
+	CreateDir(dst)
+	part := filepath.Join(dst, "tinker.img"+partSuffix)
+	ioutil.WriteFile(part, content[:5000], 0644)
+	state := &resumeState{URL: rawurl, LastModified: info.LastModified, Length: info.Length}
+	state.save(part)
+
+	var offset int64 = -1
+	d.Progress = ProgressFunc(func(e ProgressEvent) {
+		if e.Type == ProgressStarted {
+			offset = e.Offset
+		}
+	})
+	name, err := d.Download(context.Background(), rawurl, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != 5000 {
+		t.Errorf("Download() started from %d, want 5000", offset)
+	}
+	b, _ := ioutil.ReadFile(filepath.Join(dst, name))
+	if !bytes.Equal(b, content) {
+		t.Error("Downloaded content differs")
+	}
+
+	if _, err := d.Source("gopher://example.com/file"); err == nil {
+		t.Error("Source() of an unknown scheme should fail")
+	}
+}
+
+func TestFetch(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(`{"releases": []}`))
+	zw.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/huge.json" {
+			w.Write(make([]byte, maxFetchSize+1))
+			return
+		}
+		w.Write(gz.Bytes())
+	}))
+	defer srv.Close()
+
+	d := NewDownloader()
+	data, err := d.Fetch(context.Background(), srv.URL+"/feed.json.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, gz.Bytes()) {
+		t.Error("Fetch() decompressed the file")
+	}
+	if _, err := d.Fetch(context.Background(), srv.URL+"/huge.json"); !errors.Is(err, ErrFetchTooLarge) {
+		t.Errorf("Fetch() error = %v, want ErrFetchTooLarge", err)
+	}
+}
@@ -0,0 +1,96 @@
+package help
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTransportCAFile(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal artifact"))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "transport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := NewDownloader()
+	d.Quiet = true
+	d.Client = &http.Client{Transport: mustTransport(t, TransportConfig{})}
+	_, err = d.Download(context.Background(), srv.URL+"/artifact.bin", dir)
+	var tlsErr *TLSError
+	if !errors.As(err, &tlsErr) {
+		t.Fatalf("Download() from an untrusted server error = %v, want TLSError", err)
+	}
+
+	caFile := filepath.Join(dir, "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, ca, 0644); err != nil {
+		t.Fatal(err)
+	}
+	d.Client = &http.Client{Transport: mustTransport(t, TransportConfig{CAFile: caFile})}
+	if _, err := d.Download(context.Background(), srv.URL+"/artifact.bin", dir); err != nil {
+		t.Errorf("Download() with the CA file error = %v", err)
+	}
+}
+
+func TestTransportProxyAuth(t *testing.T) {
+	var auth, target string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth, target = r.Header.Get("Proxy-Authorization"), r.URL.String()
+		w.Write([]byte("proxied"))
+	}))
+	defer proxy.Close()
+
+	d := NewDownloader()
+	d.Client = &http.Client{Transport: mustTransport(t, TransportConfig{
+		ProxyURL: "http://user:secret@" + proxy.Listener.Addr().String(),
+		NoProxy:  "localhost,.internal",
+	})}
+	info, err := d.RemoteInfo(context.Background(), "http://images.example.com/rpi.img")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Length != int64(len("proxied")) {
+		t.Errorf("RemoteInfo() length = %d, want %d", info.Length, len("proxied"))
+	}
+	if want := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:secret")); auth != want {
+		t.Errorf("Proxy-Authorization = %q, want %q", auth, want)
+	}
+	if target != "http://images.example.com/rpi.img" {
+		t.Errorf("Proxied url = %q", target)
+	}
+
+	for _, tt := range []struct {
+		host string
+		want bool
+	}{
+		{"localhost", true},
+		{"artifacts.internal", true},
+		{"internal", false},
+		{"example.com", false},
+	} {
+		if got := bypassProxy(tt.host, "localhost,.internal"); got != tt.want {
+			t.Errorf("%q. bypassProxy() = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func mustTransport(t *testing.T, cfg TransportConfig) *http.Transport {
+	tr, err := NewTransport(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
@@ -0,0 +1,227 @@
+package help
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Constraint is a set of version ranges like ">=1.2 <2", "~1.4", "^2.0" or "1.x || >=3.1".
+// Comparisons separated by spaces or commas must all match, ranges separated by || are alternatives.
+// Partial versions cover all their releases: "1.2" is ">=1.2.0 <1.3.0-0", "<2" excludes 2.0.0 prereleases,
+// "~1.4.2" is ">=1.4.2 <1.5.0-0" and "^0.2.3" is ">=0.2.3 <0.3.0-0"
+type Constraint struct {
+	raw    string
+	ranges [][]comparison
+}
+
+type comparison struct {
+	op      string
+	version *Version
+}
+
+func (c comparison) match(v *Version) bool {
+	cmp := v.Compare(c.version)
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+// ParseConstraint parses a constraint expression
+func ParseConstraint(s string) (*Constraint, error) {
+	c := &Constraint{raw: s}
+	for _, alt := range strings.Split(s, "||") {
+		fields := strings.Fields(strings.Replace(alt, ",", " ", -1))
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("invalid constraint %q: empty range", s)
+		}
+
+		var r []comparison
+		for i := 0; i < len(fields); i++ {
+			term := fields[i]
+			// ">= 1.2" is written with a space
+			if strings.Trim(term, "<>=!~^") == "" && i+1 < len(fields) {
+				i++
+				term += fields[i]
+			}
+			cs, err := parseComparison(term)
+			if err != nil {
+				return nil, fmt.Errorf("invalid constraint %q: %s", s, err.Error())
+			}
+			r = append(r, cs...)
+		}
+		c.ranges = append(c.ranges, r)
+	}
+	return c, nil
+}
+
+// MustParseConstraint is like ParseConstraint but panics on errors, for declaring
+// minimum versions in variables
+func MustParseConstraint(s string) *Constraint {
+	c, err := ParseConstraint(s)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// parseComparison expands a single term into comparisons of full versions
+func parseComparison(term string) ([]comparison, error) {
+	op := term[:len(term)-len(strings.TrimLeft(term, "<>=!~^"))]
+	v, n, err := parsePartial(term[len(op):])
+	if err != nil {
+		return nil, err
+	}
+
+	// upper bounds exclude prereleases of the next version
+	next := func(parts int) *Version {
+		u := &Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch, Prerelease: []string{"0"}}
+		switch parts {
+		case 0:
+			u.Major++
+			u.Minor, u.Patch = 0, 0
+		case 1:
+			u.Minor++
+			u.Patch = 0
+		default:
+			u.Patch++
+		}
+		return u
+	}
+	between := func(upper *Version) []comparison {
+		return []comparison{{">=", v}, {"<", upper}}
+	}
+
+	if n == 0 {
+		// * matches every version
+		if op != "" && op != "=" && op != ">=" && op != "~" && op != "^" {
+			return nil, fmt.Errorf("%q can't be used with a wildcard", op)
+		}
+		return []comparison{{">=", &Version{}}}, nil
+	}
+
+	switch op {
+	case "", "=", "==":
+		if n == 3 {
+			return []comparison{{"=", v}}, nil
+		}
+		return between(next(n - 1)), nil
+	case "!=":
+		if n < 3 {
+			return nil, fmt.Errorf("%q needs a full version", term)
+		}
+		return []comparison{{"!=", v}}, nil
+	case ">":
+		if n < 3 {
+			return []comparison{{">=", next(n - 1)}}, nil
+		}
+		return []comparison{{">", v}}, nil
+	case ">=":
+		return []comparison{{">=", v}}, nil
+	case "<":
+		if n < 3 {
+			bound := *v
+			bound.Prerelease = []string{"0"}
+			return []comparison{{"<", &bound}}, nil
+		}
+		return []comparison{{"<", v}}, nil
+	case "<=":
+		if n < 3 {
+			return []comparison{{"<", next(n - 1)}}, nil
+		}
+		return []comparison{{"<=", v}}, nil
+	case "~":
+		if n == 1 {
+			return between(next(0)), nil
+		}
+		return between(next(1)), nil
+	case "^":
+		switch {
+		case v.Major > 0 || n == 1:
+			return between(next(0)), nil
+		case v.Minor > 0 || n == 2:
+			return between(next(1)), nil
+		}
+		return between(next(2)), nil
+	}
+
+	return nil, fmt.Errorf("unknown operator %q", op)
+}
+
+// parsePartial parses versions with missing or wildcard components, returns the number of given components
+func parsePartial(s string) (*Version, int, error) {
+	if len(s) > 1 && (s[0] == 'v' || s[0] == 'V') {
+		s = s[1:]
+	}
+	core, suffix := s, ""
+	if i := strings.IndexAny(s, "-+"); i > -1 {
+		core, suffix = s[:i], s[i:]
+	}
+
+	parts := strings.Split(core, ".")
+	if len(parts) > 3 {
+		return nil, 0, fmt.Errorf("invalid version %q", s)
+	}
+	// components after a wildcard are ignored: 1.x.x
+	n := 0
+	for _, p := range parts {
+		if p == "*" || p == "x" || p == "X" {
+			break
+		}
+		n++
+	}
+	if n == 0 {
+		return &Version{}, 0, nil
+	}
+	if n < 3 && suffix != "" {
+		return nil, 0, fmt.Errorf("invalid version %q: prerelease of a partial version", s)
+	}
+
+	v, err := ParseVersion(strings.Join(parts[:n], ".") + strings.Repeat(".0", 3-n) + suffix)
+	if err != nil {
+		return nil, 0, err
+	}
+	return v, n, nil
+}
+
+// Check returns true if the version matches the constraint
+func (c *Constraint) Check(v *Version) bool {
+	for _, r := range c.ranges {
+		ok := true
+		for _, cmp := range r {
+			if !cmp.match(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckString parses the version in the tolerant mode and checks it
+func (c *Constraint) CheckString(version string) (bool, error) {
+	v, err := ParseVersionTolerant(version)
+	if err != nil {
+		return false, err
+	}
+	return c.Check(v), nil
+}
+
+// String returns the expression of the constraint
+func (c *Constraint) String() string {
+	return c.raw
+}
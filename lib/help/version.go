@@ -0,0 +1,238 @@
+package help
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidVersion is returned for strings which are not versions
+var ErrInvalidVersion = errors.New("invalid version")
+
+// Version is a semantic version, see https://semver.org
+type Version struct {
+	Major, Minor, Patch uint64
+	// Prerelease and Build are the dot separated identifiers after - and +
+	Prerelease []string
+	Build      []string
+	// extra holds numeric components after the patch of tolerant versions like 4.19.0.1
+	extra []uint64
+}
+
+// ParseVersion parses a SemVer 2.0 string, a leading v is allowed
+func ParseVersion(s string) (*Version, error) {
+	v, err := parseVersion(s, false)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %s", ErrInvalidVersion, s, err.Error())
+	}
+	return v, nil
+}
+
+// ParseVersionTolerant parses distro style versions as well: prefixes like "v" or "rev", leading zeros,
+// missing or extra components and suffixes without a dash, so "rev120" is 120.0.0, "v01" is 1.0.0
+// and "1.0rc1" is 1.0.0-rc1
+func ParseVersionTolerant(s string) (*Version, error) {
+	v, err := parseVersion(s, true)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %s", ErrInvalidVersion, s, err.Error())
+	}
+	return v, nil
+}
+
+// MustParseVersion is like ParseVersionTolerant but panics on errors, for declaring versions in variables
+func MustParseVersion(s string) *Version {
+	v, err := ParseVersionTolerant(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func parseVersion(s string, tolerant bool) (*Version, error) {
+	s = strings.TrimSpace(s)
+	if tolerant {
+		s = strings.TrimLeftFunc(s, func(r rune) bool { return !unicode.IsDigit(r) })
+	} else if len(s) > 1 && (s[0] == 'v' || s[0] == 'V') {
+		s = s[1:]
+	}
+
+	v := &Version{}
+	if i := strings.IndexByte(s, '+'); i > -1 {
+		v.Build = strings.Split(s[i+1:], ".")
+		s = s[:i]
+		if err := checkIdentifiers(v.Build, false, tolerant); err != nil {
+			return nil, err
+		}
+	}
+
+	core, pre := s, ""
+	if i := strings.IndexByte(s, '-'); i > -1 {
+		core, pre = s[:i], s[i+1:]
+	} else if tolerant {
+		// 1.0rc1 and 1.0~beta2 have a prerelease without a dash
+		if i := strings.IndexFunc(s, func(r rune) bool { return r != '.' && !unicode.IsDigit(r) }); i > -1 {
+			core, pre = strings.TrimRight(s[:i], "."), strings.TrimLeft(s[i:], "~_.")
+		}
+	}
+
+	numbers := strings.Split(core, ".")
+	if !tolerant && len(numbers) != 3 {
+		return nil, errors.New("major.minor.patch expected")
+	}
+	for i, n := range numbers {
+		if n == "" || strings.TrimLeftFunc(n, unicode.IsDigit) != "" {
+			return nil, fmt.Errorf("invalid number %q", n)
+		}
+		if !tolerant && len(n) > 1 && n[0] == '0' {
+			return nil, fmt.Errorf("leading zero in %q", n)
+		}
+		val, err := strconv.ParseUint(n, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		switch i {
+		case 0:
+			v.Major = val
+		case 1:
+			v.Minor = val
+		case 2:
+			v.Patch = val
+		default:
+			v.extra = append(v.extra, val)
+		}
+	}
+
+	if pre != "" || strings.Contains(s, "-") {
+		v.Prerelease = strings.Split(pre, ".")
+		if err := checkIdentifiers(v.Prerelease, true, tolerant); err != nil {
+			return nil, err
+		}
+	}
+
+	return v, nil
+}
+
+// checkIdentifiers validates prerelease or build identifiers, numeric prerelease
+// identifiers can't have leading zeros
+func checkIdentifiers(ids []string, prerelease, tolerant bool) error {
+	for _, id := range ids {
+		if id == "" {
+			return errors.New("empty identifier")
+		}
+		for _, r := range id {
+			if r > unicode.MaxASCII || !(r == '-' || unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				return fmt.Errorf("invalid identifier %q", id)
+			}
+		}
+		if prerelease && !tolerant && len(id) > 1 && id[0] == '0' && isNumeric(id) {
+			return fmt.Errorf("leading zero in %q", id)
+		}
+	}
+	return nil
+}
+
+func isNumeric(s string) bool {
+	return s != "" && strings.TrimLeftFunc(s, unicode.IsDigit) == ""
+}
+
+// String returns the canonical form of the version without the leading v
+func (v *Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	for _, e := range v.extra {
+		s += fmt.Sprintf(".%d", e)
+	}
+	if len(v.Prerelease) > 0 {
+		s += "-" + strings.Join(v.Prerelease, ".")
+	}
+	if len(v.Build) > 0 {
+		s += "+" + strings.Join(v.Build, ".")
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 if v is lower, equal or greater than o by SemVer precedence:
+// a prerelease is lower than its release and build metadata is ignored
+func (v *Version) Compare(o *Version) int {
+	if c := compareNumbers([]uint64{v.Major, v.Minor, v.Patch}, []uint64{o.Major, o.Minor, o.Patch}); c != 0 {
+		return c
+	}
+	if c := compareNumbers(v.extra, o.extra); c != 0 {
+		return c
+	}
+
+	switch {
+	case len(v.Prerelease) == 0 && len(o.Prerelease) == 0:
+		return 0
+	case len(v.Prerelease) == 0:
+		return 1
+	case len(o.Prerelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(v.Prerelease) && i < len(o.Prerelease); i++ {
+		if c := compareIdentifiers(v.Prerelease[i], o.Prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(v.Prerelease), len(o.Prerelease))
+}
+
+// LessThan returns true if v is lower than o
+func (v *Version) LessThan(o *Version) bool {
+	return v.Compare(o) < 0
+}
+
+// Equal returns true if v and o have the same precedence
+func (v *Version) Equal(o *Version) bool {
+	return v.Compare(o) == 0
+}
+
+// compareNumbers compares components in order, missing components are zeros
+func compareNumbers(a, b []uint64) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y uint64
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+// compareIdentifiers compares numeric identifiers by value, they are lower than alphanumeric ones
+func compareIdentifiers(a, b string) int {
+	an, bn := isNumeric(a), isNumeric(b)
+	switch {
+	case an && bn:
+		a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+		if c := compareInts(len(a), len(b)); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	case an:
+		return -1
+	case bn:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,126 @@
+package help
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"1.2.3", "1.2.3", false},
+		{"v1.0.0-rc.1+build.5", "1.0.0-rc.1+build.5", false},
+		{"1.2", "", true},
+		{"01.2.3", "", true},
+		{"1.2.3-01", "", true},
+		{"1.2.3-", "", true},
+		{"1.2.3-rc_1", "", true},
+	}
+	for _, tt := range tests {
+		v, err := ParseVersion(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q. ParseVersion() error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && v.String() != tt.want {
+			t.Errorf("%q. ParseVersion() = %s, want %s", tt.in, v, tt.want)
+		}
+	}
+}
+
+func TestParseVersionTolerant(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"rev120", "120.0.0"},
+		{"v01", "1.0.0"},
+		{"1.0rc1", "1.0.0-rc1"},
+		{"4.19.0.1", "4.19.0.1"},
+		{"2.1~beta2", "2.1.0-beta2"},
+	}
+	for _, tt := range tests {
+		v, err := ParseVersionTolerant(tt.in)
+		if err != nil {
+			t.Errorf("%q. ParseVersionTolerant() error = %v", tt.in, err)
+			continue
+		}
+		if v.String() != tt.want {
+			t.Errorf("%q. ParseVersionTolerant() = %s, want %s", tt.in, v, tt.want)
+		}
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	// in ascending order, from the SemVer spec
+	ordered := []string{
+		"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2",
+		"1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.2.0", "1.10.0", "4.19.0.1", "rev120",
+	}
+	for i := 0; i+1 < len(ordered); i++ {
+		a, b := MustParseVersion(ordered[i]), MustParseVersion(ordered[i+1])
+		if a.Compare(b) != -1 || b.Compare(a) != 1 {
+			t.Errorf("%q. Compare(%q) = %d, want -1", ordered[i], ordered[i+1], a.Compare(b))
+		}
+	}
+
+	if !MustParseVersion("v01").Equal(MustParseVersion("1.0.0+build")) {
+		t.Error("v01 is not equal to 1.0.0+build")
+	}
+	if !MustParseVersion("1.0.0-rc1").LessThan(MustParseVersion("1.0.0")) {
+		t.Error("1.0.0-rc1 is not less than 1.0.0")
+	}
+}
+
+func TestConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{">=1.2 <2", "1.2.0", true},
+		{">=1.2 <2", "1.9.9", true},
+		{">=1.2 <2", "2.0.0", false},
+		{">=1.2 <2", "2.0.0-rc1", false},
+		{">=1.2 <2", "1.1.9", false},
+		{">= 1.2, < 2", "1.5.0", true},
+		{"~1.4", "1.4.7", true},
+		{"~1.4", "1.5.0", false},
+		{"~1.4.2", "1.4.1", false},
+		{"^2.0", "2.9.0", true},
+		{"^2.0", "3.0.0", false},
+		{"^0.2.3", "0.2.9", true},
+		{"^0.2.3", "0.3.0", false},
+		{"1.2", "1.2.5", true},
+		{"1.2.x", "1.3.0", false},
+		{">1.2", "1.2.9", false},
+		{"<=1.2", "1.2.9", true},
+		{"!=1.2.3", "1.2.3", false},
+		{"1.x || >=3.1", "3.2.0", true},
+		{"1.x || >=3.1", "2.0.0", false},
+		{"*", "0.0.1", true},
+		{">=1.0.0-rc.1", "1.0.0-rc.2", true},
+		{">=4.19", "rev120", true},
+	}
+	for _, tt := range tests {
+		c, err := ParseConstraint(tt.constraint)
+		if err != nil {
+			t.Errorf("%q. ParseConstraint() error = %v", tt.constraint, err)
+			continue
+		}
+		got, err := c.CheckString(tt.version)
+		if err != nil {
+			t.Errorf("%q. CheckString(%q) error = %v", tt.constraint, tt.version, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q. CheckString(%q) = %v, want %v", tt.constraint, tt.version, got, tt.want)
+		}
+	}
+
+	for _, s := range []string{"", ">=1.2 ||", "=>1.2", "1.2-rc1", "<*", "1.2.3.4", ">=abc"} {
+		if _, err := ParseConstraint(s); err == nil {
+			t.Errorf("%q. ParseConstraint() succeeded", s)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package release
+
+import (
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/xshellinc/tools/constants"
+	"github.com/xshellinc/tools/lib/help"
+)
+
+// archAliases are the names used for architectures in asset names
+var archAliases = map[string][]string{
+	constants.AMD64: {"amd64", "x86_64", "x86-64", "x64"},
+	constants.ARM64: {"arm64", "aarch64", "armv8"},
+	constants.ARMv7: {"armv7", "armv7l", "armhf", "arm7"},
+	constants.ARMv6: {"armv6", "armv6l", "arm6"},
+	constants.ARMv5: {"armv5", "armel", "arm5"},
+	constants.X86:   {"386", "i386", "i686", "x86"},
+}
+
+// archFallbacks are the architectures able to run binaries of an older one
+var archFallbacks = map[string][]string{
+	constants.ARMv7: {constants.ARMv6, constants.ARMv5},
+	constants.ARMv6: {constants.ARMv5},
+}
+
+// osAliases are the names used for operating systems in asset names
+var osAliases = map[string][]string{
+	"linux":   {"linux"},
+	"darwin":  {"darwin", "macos", "osx"},
+	"windows": {"windows", "win64", "win32"},
+	"freebsd": {"freebsd"},
+}
+
+var tokenSeparator = regexp.MustCompile(`[^a-z0-9]+`)
+
+// NormalizeArch converts machine names such as x86_64, aarch64 or armv7l and go names
+// into the architecture constants, unknown names are returned in lower case
+func NormalizeArch(arch string) string {
+	arch = strings.ToLower(strings.TrimSpace(arch))
+	switch {
+	case arch == "x86_64" || arch == "amd64":
+		return constants.AMD64
+	case arch == "aarch64" || arch == "arm64" || arch == "armv8" || strings.HasPrefix(arch, "armv8"):
+		return constants.ARM64
+	case strings.HasPrefix(arch, "armv7"):
+		return constants.ARMv7
+	case strings.HasPrefix(arch, "armv6"):
+		return constants.ARMv6
+	case strings.HasPrefix(arch, "armv5"):
+		return constants.ARMv5
+	case arch == "386" || arch == "i386" || arch == "i686":
+		return constants.X86
+	}
+	return arch
+}
+
+// HostArch returns the architecture of the host, runtime.GOARCH is used when uname fails
+func HostArch() string {
+	if arch, err := help.GetArch(); err == nil && arch != "" {
+		return NormalizeArch(arch)
+	}
+	return NormalizeArch(runtime.GOARCH)
+}
+
+// tokens splits an asset name into lower case words
+func tokens(name string) map[string]bool {
+	set := make(map[string]bool)
+	for _, t := range tokenSeparator.Split(strings.ToLower(name), -1) {
+		set[t] = true
+	}
+	// x86_64 and x86-64 are split in two words
+	lower := strings.ToLower(name)
+	for _, alias := range []string{"x86_64", "x86-64"} {
+		if strings.Contains(lower, alias) {
+			set[alias] = true
+		}
+	}
+	return set
+}
+
+// assetArch returns the architecture of the asset, detected from its name unless it is set
+func assetArch(a Asset) string {
+	if a.Arch != "" {
+		return NormalizeArch(a.Arch)
+	}
+	words := tokens(a.Name)
+	// amd64 goes first as x86_64 contains x86
+	for _, arch := range []string{constants.AMD64, constants.ARM64, constants.ARMv7, constants.ARMv6, constants.ARMv5, constants.X86} {
+		for _, alias := range archAliases[arch] {
+			if words[alias] {
+				return arch
+			}
+		}
+	}
+	return ""
+}
+
+// assetOS returns the operating system of the asset, detected from its name unless it is set
+func assetOS(a Asset) string {
+	if a.OS != "" {
+		return strings.ToLower(a.OS)
+	}
+	words := tokens(a.Name)
+	for os, aliases := range osAliases {
+		for _, alias := range aliases {
+			if words[alias] {
+				return os
+			}
+		}
+	}
+	return ""
+}
+
+// matchAsset returns the asset built for the os and the architecture or a compatible one
+func matchAsset(assets []Asset, os, arch string) (Asset, bool) {
+	arch = NormalizeArch(arch)
+	for _, candidate := range append([]string{arch}, archFallbacks[arch]...) {
+		for _, a := range assets {
+			if isChecksumFile(a.Name) || assetArch(a) != candidate {
+				continue
+			}
+			if aos := assetOS(a); os != "" && aos != "" && aos != strings.ToLower(os) {
+				continue
+			}
+			return a, true
+		}
+	}
+	return Asset{}, false
+}
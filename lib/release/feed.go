@@ -0,0 +1,149 @@
+package release
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Asset is a downloadable file of a release
+type Asset struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	Size int64  `json:"size,omitempty"`
+	// Digest is the published checksum in the `algorithm:hex` form
+	Digest string `json:"digest,omitempty"`
+	// SignatureURL is a detached signature of the asset
+	SignatureURL string `json:"signature,omitempty"`
+	// OS and Arch are detected from the name when they are empty
+	OS   string `json:"os,omitempty"`
+	Arch string `json:"arch,omitempty"`
+}
+
+// Release is a version of the software with its assets
+type Release struct {
+	Version    string    `json:"version"`
+	Prerelease bool      `json:"prerelease,omitempty"`
+	Published  time.Time `json:"published,omitempty"`
+	Assets     []Asset   `json:"assets"`
+	// ChecksumURL is a checksum file such as SHA256SUMS listing digests of the assets
+	ChecksumURL string `json:"checksums,omitempty"`
+}
+
+// manifest is our own feed format
+type manifest struct {
+	Releases []Release `json:"releases"`
+}
+
+// githubRelease is an entry of the GitHub releases api
+type githubRelease struct {
+	TagName     string    `json:"tag_name"`
+	Draft       bool      `json:"draft"`
+	Prerelease  bool      `json:"prerelease"`
+	PublishedAt time.Time `json:"published_at"`
+	Assets      []struct {
+		Name               string `json:"name"`
+		BrowserDownloadURL string `json:"browser_download_url"`
+		Size               int64  `json:"size"`
+		Digest             string `json:"digest"`
+	} `json:"assets"`
+}
+
+// checksumNames are assets listing digests of the other assets
+var checksumNames = []string{"sha256sums", "sha512sums", "checksums.txt", "checksums.sha256"}
+
+// isChecksumFile returns true for checksum and signature files
+func isChecksumFile(name string) bool {
+	name = strings.ToLower(name)
+	for _, n := range checksumNames {
+		if name == n || strings.HasSuffix(name, "_"+n) || strings.HasSuffix(name, "-"+n) {
+			return true
+		}
+	}
+	return strings.HasSuffix(name, ".sha256") || strings.HasSuffix(name, ".sha512") || isSignatureFile(name)
+}
+
+func isSignatureFile(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasSuffix(name, ".sig") || strings.HasSuffix(name, ".asc") || strings.HasSuffix(name, ".minisig")
+}
+
+// ParseFeed parses a GitHub releases response, a list or a single release,
+// or a manifest of the {"releases": [...]} form
+func ParseFeed(data []byte) ([]Release, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, errors.New("empty release feed")
+	}
+
+	if data[0] == '[' {
+		var gh []githubRelease
+		if err := json.Unmarshal(data, &gh); err != nil {
+			return nil, err
+		}
+		return fromGithub(gh), nil
+	}
+
+	var probe struct {
+		TagName  *string         `json:"tag_name"`
+		Releases json.RawMessage `json:"releases"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case probe.TagName != nil:
+		var gh githubRelease
+		if err := json.Unmarshal(data, &gh); err != nil {
+			return nil, err
+		}
+		return fromGithub([]githubRelease{gh}), nil
+	case probe.Releases != nil:
+		var m manifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		return m.Releases, nil
+	}
+
+	return nil, errors.New("unknown release feed format")
+}
+
+// fromGithub converts GitHub releases skipping drafts, checksum files become the ChecksumURL
+func fromGithub(gh []githubRelease) []Release {
+	var releases []Release
+	for _, g := range gh {
+		if g.Draft {
+			continue
+		}
+
+		r := Release{Version: g.TagName, Prerelease: g.Prerelease, Published: g.PublishedAt}
+		for _, a := range g.Assets {
+			if isChecksumFile(a.Name) {
+				if r.ChecksumURL == "" && !isSignatureFile(a.Name) {
+					r.ChecksumURL = a.BrowserDownloadURL
+				}
+				continue
+			}
+			r.Assets = append(r.Assets, Asset{Name: a.Name, URL: a.BrowserDownloadURL, Size: a.Size, Digest: a.Digest})
+		}
+		// signatures are published next to the assets as name.sig, name.asc or name.minisig
+		for _, a := range g.Assets {
+			if !isSignatureFile(a.Name) {
+				continue
+			}
+			for i := range r.Assets {
+				if strings.TrimSuffix(a.Name, filepath.Ext(a.Name)) == r.Assets[i].Name {
+					r.Assets[i].SignatureURL = a.BrowserDownloadURL
+				}
+			}
+		}
+		releases = append(releases, r)
+	}
+
+	return releases
+}
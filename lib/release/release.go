@@ -0,0 +1,170 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xshellinc/tools/lib/help"
+)
+
+// ErrNoRelease is returned when no release of the feed has an asset for the platform
+var ErrNoRelease = errors.New("no release found for the platform")
+
+// Resolver finds the newest release asset for an architecture in a release feed
+type Resolver struct {
+	// FeedURL is a GitHub releases api url or a url of our manifest
+	FeedURL string
+	// Downloader fetches the feed and the asset, its credentials are used for both
+	Downloader *help.Downloader
+	// Prerelease allows releases marked as prereleases
+	Prerelease bool
+	// OS and Arch select the asset, the host platform is used when they are empty,
+	// Arch takes the constants.ARMv7, constants.ARM64... values or machine names like aarch64
+	OS   string
+	Arch string
+}
+
+// NewResolver returns a resolver of the feed for the host platform
+func NewResolver(feedURL string) *Resolver {
+	return &Resolver{FeedURL: feedURL, Downloader: help.NewDownloader()}
+}
+
+func (r *Resolver) downloader() *help.Downloader {
+	if r.Downloader == nil {
+		r.Downloader = help.NewDownloader()
+	}
+	return r.Downloader
+}
+
+func (r *Resolver) platform() (string, string) {
+	os, arch := r.OS, r.Arch
+	if os == "" {
+		os = runtime.GOOS
+	}
+	if arch == "" {
+		arch = HostArch()
+	}
+	return os, NormalizeArch(arch)
+}
+
+// Releases downloads and parses the feed
+func (r *Resolver) Releases(ctx context.Context) ([]Release, error) {
+	data, err := r.downloader().Fetch(ctx, r.FeedURL)
+	if err != nil {
+		return nil, fmt.Errorf("can't fetch release feed %s: %w", r.FeedURL, err)
+	}
+	return ParseFeed(data)
+}
+
+// Latest returns the newest release having an asset for the platform along with the asset
+func (r *Resolver) Latest(ctx context.Context) (*Release, *Asset, error) {
+	releases, err := r.Releases(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	os, arch := r.platform()
+	release, asset, ok := Latest(releases, os, arch, r.Prerelease)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s/%s in %s", ErrNoRelease, os, arch, r.FeedURL)
+	}
+	log.WithField("version", release.Version).Debug("Found release asset ", asset.Name)
+	return release, asset, nil
+}
+
+// Download downloads the asset of the newest release into the destination folder,
+// returns the path of the file. See DownloadAsset
+func (r *Resolver) Download(ctx context.Context, destination string) (string, *Release, error) {
+	release, asset, err := r.Latest(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	file, err := r.DownloadAsset(ctx, release, asset, destination)
+	return file, release, err
+}
+
+// DownloadAsset downloads the asset into the destination folder verifying it with the published
+// digest or checksum file, and its signature when the downloader has a Verifier.
+// Returns the path of the file
+func (r *Resolver) DownloadAsset(ctx context.Context, release *Release, asset *Asset, destination string) (string, error) {
+	d, err := r.assetDownloader(release, asset)
+	if err != nil {
+		return "", err
+	}
+	fileName, err := d.Download(ctx, asset.URL, destination)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(destination, fileName), nil
+}
+
+// assetDownloader returns a copy of the downloader expecting the checksum of the asset
+func (r *Resolver) assetDownloader(release *Release, asset *Asset) (*help.Downloader, error) {
+	d := *r.downloader()
+	d.FileName = asset.Name
+	d.Digest, d.ChecksumURL, d.SignatureURL = help.Digest{}, "", asset.SignatureURL
+
+	switch {
+	case asset.Digest != "":
+		digest, err := help.ParseDigest(asset.Digest)
+		if err != nil {
+			return nil, err
+		}
+		d.Digest = digest
+	case release.ChecksumURL != "":
+		d.ChecksumURL = release.ChecksumURL
+	}
+
+	return &d, nil
+}
+
+// Latest returns the newest release having an asset for the os and the architecture,
+// versions are compared with CompareVersions
+func Latest(releases []Release, os, arch string, prerelease bool) (*Release, *Asset, bool) {
+	var (
+		latest *Release
+		found  Asset
+	)
+	for i := range releases {
+		rel := &releases[i]
+		if rel.Prerelease && !prerelease {
+			continue
+		}
+		if latest != nil && CompareVersions(rel.Version, latest.Version) <= 0 {
+			continue
+		}
+		if asset, ok := matchAsset(rel.Assets, os, arch); ok {
+			latest, found = rel, asset
+		}
+	}
+
+	if latest == nil {
+		return nil, nil, false
+	}
+	return latest, &found, true
+}
+
+// CompareVersions compares versions by SemVer precedence, so prereleases are lower than
+// their releases. Tags which are not versions are compared with help.CompareVersions ignoring a leading v
+func CompareVersions(a, b string) int {
+	va, erra := help.ParseVersionTolerant(a)
+	vb, errb := help.ParseVersionTolerant(b)
+	if erra == nil && errb == nil {
+		return va.Compare(vb)
+	}
+	return help.CompareVersions(trimVersion(a), trimVersion(b))
+}
+
+func trimVersion(v string) string {
+	v = strings.TrimSpace(v)
+	if len(v) > 1 && (v[0] == 'v' || v[0] == 'V') && v[1] >= '0' && v[1] <= '9' {
+		return v[1:]
+	}
+	return v
+}
@@ -0,0 +1,138 @@
+package release
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xshellinc/tools/constants"
+)
+
+func TestNormalizeArch(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"x86_64", constants.AMD64},
+		{"aarch64", constants.ARM64},
+		{"armv7l", constants.ARMv7},
+		{"armv6", constants.ARMv6},
+		{"i686", constants.X86},
+		{"mips", "mips"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeArch(tt.in); got != tt.want {
+			t.Errorf("%q. NormalizeArch() = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLatest(t *testing.T) {
+	releases := []Release{
+		{Version: "v1.9.0", Assets: []Asset{{Name: "tool_linux_armv6.tar.gz"}, {Name: "tool_linux_x86_64.tar.gz"}}},
+		{Version: "v1.10.0", Assets: []Asset{{Name: "tool_linux_arm64.tar.gz"}, {Name: "tool_darwin_x86_64.tar.gz"}}},
+		{Version: "v2.0.0-rc1", Prerelease: true, Assets: []Asset{{Name: "tool_linux_armv7.tar.gz"}}},
+	}
+
+	tests := []struct {
+		os, arch   string
+		prerelease bool
+		version    string
+		asset      string
+	}{
+		{"linux", "aarch64", false, "v1.10.0", "tool_linux_arm64.tar.gz"},
+		{"linux", constants.AMD64, false, "v1.9.0", "tool_linux_x86_64.tar.gz"},
+		{"darwin", constants.AMD64, false, "v1.10.0", "tool_darwin_x86_64.tar.gz"},
+		// armv7 runs armv6 binaries
+		{"linux", constants.ARMv7, false, "v1.9.0", "tool_linux_armv6.tar.gz"},
+		{"linux", constants.ARMv7, true, "v2.0.0-rc1", "tool_linux_armv7.tar.gz"},
+		{"linux", constants.X86, false, "", ""},
+	}
+	for _, tt := range tests {
+		name := tt.os + "/" + tt.arch
+		rel, asset, ok := Latest(releases, tt.os, tt.arch, tt.prerelease)
+		if !ok {
+			if tt.version != "" {
+				t.Errorf("%q. Latest() found nothing, want %s", name, tt.version)
+			}
+			continue
+		}
+		if rel.Version != tt.version || asset.Name != tt.asset {
+			t.Errorf("%q. Latest() = %s %s, want %s %s", name, rel.Version, asset.Name, tt.version, tt.asset)
+		}
+	}
+}
+
+func TestResolverDownload(t *testing.T) {
+	binary := []byte("arm64 binary")
+	sum := sha256.Sum256(binary)
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/releases", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[
+			{"tag_name": "v0.3.0", "draft": true, "assets": [{"name": "tool-linux-arm64", "browser_download_url": "%[1]s/broken"}]},
+			{"tag_name": "v0.2.0", "assets": [
+				{"name": "tool-linux-arm64", "browser_download_url": "%[1]s/v0.2.0/tool-linux-arm64"},
+				{"name": "SHA256SUMS", "browser_download_url": "%[1]s/v0.2.0/SHA256SUMS"}
+			]},
+			{"tag_name": "v0.1.0", "assets": [{"name": "tool-linux-arm64", "browser_download_url": "%[1]s/broken"}]}
+		]`, srv.URL)
+	})
+	mux.HandleFunc("/v0.2.0/tool-linux-arm64", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(binary)
+	})
+	mux.HandleFunc("/v0.2.0/SHA256SUMS", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s  tool-linux-arm64\n", hex.EncodeToString(sum[:]))
+	})
+
+	dir, err := ioutil.TempDir("", "release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := NewResolver(srv.URL + "/releases")
+	r.Downloader.Quiet = true
+	r.OS, r.Arch = "linux", "aarch64"
+
+	file, rel, err := r.Download(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel.Version != "v0.2.0" || rel.ChecksumURL == "" {
+		t.Errorf("Download() release = %+v", rel)
+	}
+	if data, _ := ioutil.ReadFile(file); string(data) != string(binary) || file != filepath.Join(dir, "tool-linux-arm64") {
+		t.Errorf("Download() = %s with %q", file, data)
+	}
+
+	r.Arch = constants.ARMv6
+	if _, _, err := r.Latest(context.Background()); !errors.Is(err, ErrNoRelease) {
+		t.Errorf("Latest() error = %v, want ErrNoRelease", err)
+	}
+}
+
+func TestParseManifest(t *testing.T) {
+	releases, err := ParseFeed([]byte(`{"releases": [{"version": "1.2", "assets": [
+		{"name": "tool", "url": "https://example.com/tool", "arch": "armv7", "os": "linux", "digest": "sha256:00"}
+	]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(releases) != 1 || len(releases[0].Assets) != 1 || releases[0].Assets[0].Arch != constants.ARMv7 {
+		t.Errorf("ParseFeed() = %+v", releases)
+	}
+	if _, err := ParseFeed([]byte(`{"name": "tool"}`)); err == nil {
+		t.Error("ParseFeed() of an unknown format succeeded")
+	}
+}
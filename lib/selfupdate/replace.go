@@ -0,0 +1,127 @@
+package selfupdate
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xshellinc/tools/lib/help"
+	"github.com/xshellinc/tools/lib/sudo"
+)
+
+// rename is replaced by tests to simulate failures
+var rename = os.Rename
+
+// replace installs the binary at the path of the executable keeping its mode,
+// sudo is used when the directory is not writable
+func (u *Updater) replace(binary, exe string) error {
+	info, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+
+	err = replaceFile(binary, exe, info.Mode().Perm())
+	if err == nil || !errors.Is(err, os.ErrPermission) || u.Password == nil {
+		return err
+	}
+
+	log.Debug("Can't replace ", exe, ": ", err.Error(), ", escalating with sudo")
+	return u.sudoReplace(binary, exe, info.Mode().Perm())
+}
+
+// backupPaths returns the paths of the new binary and the backup of the old one next to the executable
+func backupPaths(exe string) (next, old string) {
+	dir, base := filepath.Dir(exe), filepath.Base(exe)
+	return filepath.Join(dir, "."+base+".new"), filepath.Join(dir, "."+base+".old")
+}
+
+// replaceFile copies the binary next to the executable and swaps them with renames,
+// so the executable is never partially written. The old binary is restored if the swap fails
+func replaceFile(binary, exe string, mode os.FileMode) error {
+	next, old := backupPaths(exe)
+	if err := copyFile(binary, next, mode); err != nil {
+		os.Remove(next)
+		return err
+	}
+	defer os.Remove(next)
+
+	os.Remove(old)
+	if err := rename(exe, old); err != nil {
+		return err
+	}
+	if err := rename(next, exe); err != nil {
+		if rerr := rename(old, exe); rerr != nil {
+			return fmt.Errorf("%s, rollback failed: %s, the previous binary is %s", err.Error(), rerr.Error(), old)
+		}
+		log.Warn("Replacing ", exe, " failed, the previous binary is restored")
+		return err
+	}
+
+	// windows doesn't delete a running executable, the backup is removed by the next update
+	if err := os.Remove(old); err != nil {
+		log.Debug("Can't remove ", old, ": ", err.Error())
+	}
+	return nil
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	// the mode of OpenFile is masked by umask
+	return os.Chmod(dst, mode)
+}
+
+// sudoReplace does the same swap as replaceFile in a root shell
+func (u *Updater) sudoReplace(binary, exe string, mode os.FileMode) error {
+	next, old := backupPaths(exe)
+	script := fmt.Sprintf("set -e; cp %[1]s %[2]s; chmod %[5]o %[2]s; rm -f %[3]s; mv -f %[4]s %[3]s; "+
+		"if ! mv -f %[2]s %[4]s; then mv -f %[3]s %[4]s; rm -f %[2]s; exit 1; fi; rm -f %[3]s",
+		quote(binary), quote(next), quote(old), quote(exe), mode)
+
+	fmt.Println("[+] Root permissions are required to replace", exe)
+	_, stderr, err := sudo.Exec(u.Password, u.PasswordData, "sh", "-c", script)
+	if err != nil {
+		return err
+	}
+
+	// sudo.Exec doesn't report the exit status, the result is checked by the content
+	expected, err := help.HashFile(binary, help.SHA256)
+	if err != nil {
+		return err
+	}
+	if err := help.VerifyFile(exe, expected); err != nil {
+		if msg := strings.TrimSpace(string(stderr)); msg != "" {
+			return fmt.Errorf("sudo replace of %s failed: %s", exe, msg)
+		}
+		return fmt.Errorf("sudo replace of %s failed: %s", exe, err.Error())
+	}
+	return nil
+}
+
+// quote quotes the path for sh
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,183 @@
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xshellinc/tools/lib/help"
+	"github.com/xshellinc/tools/lib/release"
+	"github.com/xshellinc/tools/lib/sudo"
+)
+
+// ErrUpToDate is returned by Update when the feed has no newer release
+var ErrUpToDate = errors.New("already up to date")
+
+// ErrUnverified is returned by Update when the release has no digest or checksum file
+// and the downloader has no Verifier, unverified binaries are never installed
+var ErrUnverified = errors.New("release can't be verified")
+
+// Updater replaces the executable with the newest release of a feed
+type Updater struct {
+	// Resolver selects the asset of the host architecture, its downloader verifies
+	// the published checksum and the signature when it has a Verifier. Releases with
+	// neither are rejected
+	Resolver *release.Resolver
+	// Version is the version of the running executable
+	Version string
+	// Executable is the binary to replace, the running executable is used when it's empty
+	Executable string
+	// Password is asked when the executable is in a directory which is not writable
+	// such as /usr/local/bin, the replacement is done with sudo. Nil disables the escalation
+	Password     sudo.PasswordCallback
+	PasswordData interface{}
+}
+
+// New returns an updater of the running executable at the version, it asks for the sudo
+// password on the terminal when needed
+func New(feedURL, version string) *Updater {
+	return &Updater{
+		Resolver: release.NewResolver(feedURL),
+		Version:  version,
+		Password: sudo.InputMaskedPassword,
+	}
+}
+
+// executable returns the path of the binary with symlinks resolved
+func (u *Updater) executable() (string, error) {
+	exe := u.Executable
+	if exe == "" {
+		var err error
+		if exe, err = os.Executable(); err != nil {
+			// GetBinPath is where our tools are installed
+			exe = filepath.Join(help.GetBinPath(), filepath.Base(os.Args[0]))
+		}
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
+// Check returns the newest release and its asset, newer is set if it's newer than the Version
+func (u *Updater) Check(ctx context.Context) (rel *release.Release, asset *release.Asset, newer bool, err error) {
+	rel, asset, err = u.Resolver.Latest(ctx)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	newer = release.CompareVersions(rel.Version, u.Version) > 0
+	return rel, asset, newer, nil
+}
+
+// Update downloads the newest release and replaces the executable with it, the previous
+// binary is restored if the replacement fails. Returns ErrUpToDate when there is nothing to do
+func (u *Updater) Update(ctx context.Context) (*release.Release, error) {
+	rel, asset, newer, err := u.Check(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !newer {
+		return nil, ErrUpToDate
+	}
+	if asset.Digest == "" && rel.ChecksumURL == "" && (u.Resolver.Downloader == nil || u.Resolver.Downloader.Verifier == nil) {
+		return nil, fmt.Errorf("%w: %s %s has no checksum or signature", ErrUnverified, rel.Version, asset.Name)
+	}
+
+	exe, err := u.executable()
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := ioutil.TempDir("", "selfupdate")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	file, err := u.Resolver.DownloadAsset(ctx, rel, asset, tmp)
+	if err != nil {
+		return nil, err
+	}
+	binary, err := unpack(file)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("[+] Updating %s from %s to %s\n", exe, u.Version, rel.Version)
+	if err := u.replace(binary, exe); err != nil {
+		return nil, err
+	}
+	fmt.Println("[+] Updated to", rel.Version)
+
+	return rel, nil
+}
+
+// unpack decompresses assets published as .gz, .xz, .bz2 or .zst, archives are not supported
+func unpack(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	header := make([]byte, 8)
+	n, _ := io.ReadFull(f, header)
+	compression := help.DetectCompression(header[:n])
+	switch compression {
+	case help.CompressionNone:
+		if isTar(file) {
+			return "", archiveError(file)
+		}
+		return file, nil
+	case help.CompressionZip:
+		return "", archiveError(file)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	r, err := help.NewDecompressor(compression, f)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	binary := file + ".bin"
+	out, err := os.Create(binary)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return "", err
+	}
+	log.Debug("Decompressed ", compression, " asset into ", binary)
+	if err := out.Close(); err != nil {
+		return "", err
+	}
+	if isTar(binary) {
+		return "", archiveError(file)
+	}
+	return binary, nil
+}
+
+func archiveError(file string) error {
+	return fmt.Errorf("%s is an archive, a binary or a compressed binary is expected", filepath.Base(file))
+}
+
+// isTar checks the ustar magic of the first header
+func isTar(file string) bool {
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	header := make([]byte, 512)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false
+	}
+	return string(header[257:262]) == "ustar"
+}
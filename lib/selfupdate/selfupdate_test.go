@@ -0,0 +1,168 @@
+package selfupdate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xshellinc/tools/constants"
+)
+
+func feedServer(binary []byte) *httptest.Server {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(binary)
+	zw.Close()
+	sum := sha256.Sum256(gz.Bytes())
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	mux.HandleFunc("/feed.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"releases": [
+			{"version": "v1.2.0", "assets": [{"name": "tool-linux-arm64.gz", "url": "%s/tool-linux-arm64.gz", "digest": "sha256:%s"}]},
+			{"version": "v1.1.0", "assets": [{"name": "tool-linux-arm64", "url": "%s/broken"}]}
+		]}`, srv.URL, hex.EncodeToString(sum[:]), srv.URL)
+	})
+	mux.HandleFunc("/tool-linux-arm64.gz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(gz.Bytes())
+	})
+	return srv
+}
+
+func TestUpdate(t *testing.T) {
+	srv := feedServer([]byte("#!/bin/sh\necho 1.2.0\n"))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "selfupdate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	exe := filepath.Join(dir, "tool")
+	ioutil.WriteFile(exe, []byte("#!/bin/sh\necho 1.1.0\n"), 0755)
+
+	u := New(srv.URL+"/feed.json", "1.1.0")
+	u.Resolver.Downloader.Quiet = true
+	u.Resolver.OS, u.Resolver.Arch = "linux", constants.ARM64
+	u.Executable = exe
+	u.Password = nil
+
+	rel, err := u.Update(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel.Version != "v1.2.0" {
+		t.Errorf("Update() = %s, want v1.2.0", rel.Version)
+	}
+	if data, _ := ioutil.ReadFile(exe); string(data) != "#!/bin/sh\necho 1.2.0\n" {
+		t.Errorf("Update() wrote %q", data)
+	}
+	if info, _ := os.Stat(exe); info.Mode().Perm() != 0755 {
+		t.Errorf("Update() mode = %s, want 0755", info.Mode())
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("Update() left %d files in the directory", len(files))
+	}
+
+	u.Version = "v1.2.0"
+	if _, err := u.Update(context.Background()); err != ErrUpToDate {
+		t.Errorf("Update() error = %v, want ErrUpToDate", err)
+	}
+}
+
+func TestUpdateUnverified(t *testing.T) {
+	downloads := 0
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	mux.HandleFunc("/feed.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"releases": [
+			{"version": "v1.2.0", "assets": [{"name": "tool-linux-arm64", "url": "%s/tool-linux-arm64"}]}
+		]}`, srv.URL)
+	})
+	mux.HandleFunc("/tool-linux-arm64", func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		w.Write([]byte("#!/bin/sh\necho 1.2.0\n"))
+	})
+
+	dir, err := ioutil.TempDir("", "selfupdate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	exe := filepath.Join(dir, "tool")
+	ioutil.WriteFile(exe, []byte("#!/bin/sh\necho 1.1.0\n"), 0755)
+
+	u := New(srv.URL+"/feed.json", "1.1.0")
+	u.Resolver.Downloader.Quiet = true
+	u.Resolver.OS, u.Resolver.Arch = "linux", constants.ARM64
+	u.Executable = exe
+	u.Password = nil
+
+	if _, err := u.Update(context.Background()); !errors.Is(err, ErrUnverified) {
+		t.Errorf("Update() error = %v, want ErrUnverified", err)
+	}
+	if downloads != 0 {
+		t.Errorf("Update() downloaded the unverified binary %d times", downloads)
+	}
+	if data, _ := ioutil.ReadFile(exe); string(data) != "#!/bin/sh\necho 1.1.0\n" {
+		t.Errorf("Update() wrote %q", data)
+	}
+}
+
+func TestReplaceRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "selfupdate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	exe := filepath.Join(dir, "tool")
+	binary := filepath.Join(dir, "download")
+	ioutil.WriteFile(exe, []byte("old"), 0755)
+	ioutil.WriteFile(binary, []byte("new"), 0644)
+
+	// the new binary can't be moved in place
+	next, _ := backupPaths(exe)
+	rename = func(from, to string) error {
+		if from == next {
+			return errors.New("disk failure")
+		}
+		return os.Rename(from, to)
+	}
+	defer func() { rename = os.Rename }()
+
+	if err := replaceFile(binary, exe, 0755); err == nil {
+		t.Error("replaceFile() succeeded")
+	}
+	if data, _ := ioutil.ReadFile(exe); string(data) != "old" {
+		t.Errorf("replaceFile() left %q, want the old binary", data)
+	}
+	if _, err := os.Stat(next); !os.IsNotExist(err) {
+		t.Errorf("replaceFile() left %s", next)
+	}
+}
+
+func TestUnpackArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "selfupdate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "tool.zip")
+	ioutil.WriteFile(file, []byte("PK\x03\x04 archive"), 0644)
+	if _, err := unpack(file); err == nil {
+		t.Error("unpack() of a zip archive succeeded")
+	}
+}
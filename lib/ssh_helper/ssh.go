@@ -1,10 +1,16 @@
 package ssh_helper
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path"
 	"runtime"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/xshellinc/easyssh"
@@ -26,6 +32,16 @@ type Util interface {
 	ScpFrom(string, string) error
 }
 
+// RateLimited is implemented by the Util of New, the limiter caps the upload speed of Scp
+type RateLimited interface {
+	SetRateLimiter(*help.RateLimiter)
+}
+
+// SftpSourcer is implemented by the Util of New, the source reads a file of the server over sftp
+type SftpSourcer interface {
+	SftpSource(string) help.Source
+}
+
 type config struct {
 	SSH easyssh.MakeConfig
 
@@ -37,6 +53,8 @@ type config struct {
 
 	retry   bool
 	verbose bool
+
+	limiter *help.RateLimiter
 }
 
 // New returns new config with default values
@@ -64,18 +82,28 @@ func (s *config) SetTimeout(timeout int) {
 	s.timeout = timeout
 }
 
+// SetRateLimiter caps the upload speed of Scp, the limiter may be shared with other transfers
+func (s *config) SetRateLimiter(l *help.RateLimiter) {
+	s.limiter = l
+}
+
 // Scp a file, directly to a destination with a workaround copying to HOME `~` and running `mv` to the destination
 func (s *config) Scp(src string, dst string) error {
 	fileName := help.FileName(src)
 
-	err := s.SSH.Scp(src, help.AddPathSuffix(runtime.GOOS, dst, fileName))
+	upload := s.SSH.Scp
+	if s.limiter != nil {
+		upload = s.scpLimited
+	}
+
+	err := upload(src, help.AddPathSuffix(runtime.GOOS, dst, fileName))
 	if err == nil {
 		return nil
 	}
 
 	log.Error(err)
 
-	if err := s.SSH.Scp(src, fileName); err != nil {
+	if err := upload(src, fileName); err != nil {
 		return err
 	}
 
@@ -106,8 +134,8 @@ func (s *config) Stream(command string) (chan string, chan string, chan bool, er
 	return s.SSH.Stream(command, s.timer)
 }
 
-// ScpFrom copies file from remote server using scp on both sides
-func (s *config) ScpFrom(src, dst string) error {
+// dial connects to the server with the password auth
+func (s *config) dial() (*ssh.Client, error) {
 	clientConfig := &ssh.ClientConfig{
 		User: s.SSH.User,
 		Auth: []ssh.AuthMethod{
@@ -115,7 +143,106 @@ func (s *config) ScpFrom(src, dst string) error {
 		},
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
 	}
-	client, err := ssh.Dial("tcp", s.SSH.Server+":"+s.SSH.Port, clientConfig)
+	return ssh.Dial("tcp", s.SSH.Server+":"+s.SSH.Port, clientConfig)
+}
+
+// scpLimited uploads the file to the dst path speaking the scp protocol directly,
+// so the data goes through the rate limiter
+func (s *config) scpLimited(src, dst string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	client, err := s.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	errOut := &bytes.Buffer{}
+	session.Stderr = errOut
+
+	dir, name := path.Split(strings.Replace(dst, `\`, "/", -1))
+	if dir == "" {
+		dir = "."
+	}
+	if err := session.Start("scp -qt " + shellQuote(dir)); err != nil {
+		return err
+	}
+
+	ack := make([]byte, 1)
+	readAck := func() error {
+		if _, err := io.ReadFull(stdout, ack); err != nil {
+			return err
+		}
+		if ack[0] != 0 {
+			msg, _ := bufio.NewReader(stdout).ReadString('\n')
+			return errors.New("scp: " + strings.TrimSpace(msg))
+		}
+		return nil
+	}
+
+	if err := readAck(); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(stdin, "C%04o %d %s\n", fi.Mode().Perm(), fi.Size(), name); err != nil {
+		return err
+	}
+	if err := readAck(); err != nil {
+		return err
+	}
+	if _, err := io.Copy(help.NewRateLimitedWriter(stdin, s.limiter), f); err != nil {
+		return err
+	}
+	if _, err := stdin.Write([]byte{0}); err != nil {
+		return err
+	}
+	if err := readAck(); err != nil {
+		return err
+	}
+	if err := stdin.Close(); err != nil {
+		return err
+	}
+
+	if err := session.Wait(); err != nil {
+		if errOut.String() != "" {
+			log.Error(errOut.String())
+		}
+		return err
+	}
+
+	return nil
+}
+
+// shellQuote quotes the argument for the remote shell
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// ScpFrom copies file from remote server using scp on both sides
+func (s *config) ScpFrom(src, dst string) error {
+	client, err := s.dial()
 	if err != nil {
 		return err
 	}
@@ -162,14 +289,7 @@ func (s *config) ScpFromServer(src, dst string) error {
 		return err
 	}
 
-	clientConfig := &ssh.ClientConfig{
-		User: s.SSH.User,
-		Auth: []ssh.AuthMethod{
-			ssh.Password(s.SSH.Password),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-	}
-	client, err := ssh.Dial("tcp", s.SSH.Server+":"+s.SSH.Port, clientConfig)
+	client, err := s.dial()
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,24 @@
+//go:build !windows
+// +build !windows
+
+package tar
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID identifies a file on a device, files with the same id are hardlinks
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// getFileID returns the id of a file with more than one link
+func getFileID(fi os.FileInfo) (fileID, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink < 2 {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
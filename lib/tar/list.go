@@ -0,0 +1,39 @@
+package tar
+
+import (
+	"context"
+	"io"
+
+	"github.com/xshellinc/tools/lib/help"
+)
+
+// List returns the entries of a tar archive, plain or compressed with gzip, bzip2, xz or zstd.
+// Other formats such as zip are rejected with help.ErrUnknownArchive, see help.List for them
+func List(src string) ([]help.ArchiveEntry, error) {
+	if err := help.CheckTarArchive(context.Background(), src); err != nil {
+		return nil, err
+	}
+	return help.List(src)
+}
+
+// ExtractMatching extracts the entries of the tar archive matching any of the patterns into
+// the dst folder and returns the written files, see help.MatchArchiveName. Other formats are rejected as in List
+func ExtractMatching(src string, patterns []string, dst string) ([]string, error) {
+	if err := help.CheckTarArchive(context.Background(), src); err != nil {
+		return nil, err
+	}
+	result, err := help.ExtractMatching(context.Background(), src, patterns, dst)
+	if result == nil {
+		return nil, err
+	}
+	return result.Files, err
+}
+
+// ExtractMatchingTo writes the first file of the tar archive matching any of the patterns into w,
+// other formats are rejected as in List
+func ExtractMatchingTo(src string, patterns []string, w io.Writer) (*help.ArchiveEntry, error) {
+	if err := help.CheckTarArchive(context.Background(), src); err != nil {
+		return nil, err
+	}
+	return help.ExtractMatchingTo(context.Background(), src, patterns, w)
+}
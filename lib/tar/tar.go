@@ -2,9 +2,7 @@ package tar
 
 import (
 	"archive/tar"
-	"compress/gzip"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -21,107 +19,43 @@ func handleError(_e error) {
 	}
 }
 
-func TarGzWrite(_path string, tw *tar.Writer, fi os.FileInfo) {
-	fr, err := os.Open(_path)
-	handleError(err)
-	defer fr.Close()
-
-	h := new(tar.Header)
-	h.Name = fr.Name()
-	h.Size = fi.Size()
-	h.Mode = int64(fi.Mode())
-	h.ModTime = fi.ModTime()
-
-	err = tw.WriteHeader(h)
-	handleError(err)
-
-	_, err = io.Copy(tw, fr)
-	handleError(err)
+// TarGzWrite writes the file into the archive, named by its path without the leading separator
+//
+// Deprecated: use Writer.AddFile
+func TarGzWrite(_path string, tw *tar.Writer, fi os.FileInfo) error {
+	name := strings.TrimPrefix(filepath.ToSlash(strings.TrimPrefix(_path, filepath.VolumeName(_path))), "/")
+	return newWriter(tw, nil).add(_path, name, fi)
 }
 
-func IterDirectory(dirPath string, tw *tar.Writer) {
-	dir, err := os.Open(dirPath)
-	handleError(err)
-	defer dir.Close()
-	fis, err := dir.Readdir(0)
-	handleError(err)
-	for _, fi := range fis {
-		curPath := dirPath + s + fi.Name()
-		if fi.IsDir() {
-			//TarGzWrite( curPath, tw, fi )
-			IterDirectory(curPath, tw)
-		} else {
-			log.Debug(curPath)
-			TarGzWrite(curPath, tw, fi)
-		}
-	}
+// IterDirectory writes the contents of the folder into the archive with names relative to it
+//
+// Deprecated: use Writer.AddDir
+func IterDirectory(dirPath string, tw *tar.Writer) error {
+	return newWriter(tw, nil).AddDir(dirPath)
 }
 
-func TarGz(outFilePath string, inPath string) {
-	// file write
-	fw, err := os.Create(outFilePath)
-	handleError(err)
-	defer fw.Close()
-
-	// gzip write
-	gw := gzip.NewWriter(fw)
-	defer gw.Close()
-
-	// tar write
-	tw := tar.NewWriter(gw)
-	defer tw.Close()
-
-	IterDirectory(inPath, tw)
+// TarGz writes the contents of inPath into the outFilePath gzipped archive with relative names
+func TarGz(outFilePath string, inPath string) error {
+	log.WithField("src", inPath).WithField("dst", outFilePath).Debug("Creating tar.gz")
+	return create(outFilePath, inPath, true, nil)
 }
 
-//TODO: This function takes absolute path for each file
-func MakeTarBall(targetFilePath string, inputDirPath string) {
-	TarGz(targetFilePath, strings.TrimRight(inputDirPath, s))
+// MakeTarBall writes the contents of the folder into the gzipped archive
+func MakeTarBall(targetFilePath string, inputDirPath string) error {
+	return TarGz(targetFilePath, strings.TrimRight(inputDirPath, s))
 }
 
+// Tarit writes the source into target/<source name>.tar, a folder is stored under its name
 func Tarit(target, source string) error {
 	filename := filepath.Base(source)
 	target = filepath.Join(target, fmt.Sprintf("%s.tar", filename))
-	tarfile, err := os.Create(target)
-
-	if err != nil {
-		return err
-	}
-	defer tarfile.Close()
-	tarball := tar.NewWriter(tarfile)
-	defer tarball.Close()
 	info, err := os.Stat(source)
 	if err != nil {
-		return nil
+		return err
 	}
-	var baseDir string
+	opts := &Options{PreserveOwner: true}
 	if info.IsDir() {
-		baseDir = filepath.Base(source)
+		opts.Prefix = filename
 	}
-	return filepath.Walk(source,
-		func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-			header, err := tar.FileInfoHeader(info, info.Name())
-			if err != nil {
-				return err
-			}
-			if baseDir != "" {
-				header.Name = filepath.Join(baseDir, strings.TrimPrefix(path, source))
-			}
-			if err := tarball.WriteHeader(header); err != nil {
-				return err
-			}
-			if info.IsDir() {
-				return nil
-			}
-			file, err := os.Open(path)
-			if err != nil {
-				return err
-			}
-			defer file.Close()
-			_, err = io.Copy(tarball, file)
-			return err
-		})
+	return create(target, source, false, opts)
 }
@@ -2,8 +2,14 @@ package tar
 
 import (
 	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func Test_handleError(t *testing.T) {
@@ -93,6 +99,15 @@ func TestMakeTarBall(t *testing.T) {
 }
 
 func TestTarit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tarit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	appjs := filepath.Join(dir, "appjs")
+	os.MkdirAll(filepath.Join(appjs, "lib"), 0755)
+	ioutil.WriteFile(filepath.Join(appjs, "lib", "index.js"), []byte("console.log('edison')"), 0644)
+
 	type args struct {
 		target string
 		source string
@@ -105,14 +120,96 @@ func TestTarit(t *testing.T) {
 		{
 			name: "test-tar-ball",
 			args: args{
-				target: "/tmp/",
-				source: "/tmp/appjs",
+				target: dir,
+				source: appjs,
 			},
 		},
+		{
+			name: "missing-source",
+			args: args{
+				target: dir,
+				source: filepath.Join(dir, "missing"),
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		if err := Tarit(tt.args.target, tt.args.source); (err != nil) != tt.wantErr {
 			t.Errorf("%q. Tarit() error = %v, wantErr %v", tt.name, err, tt.wantErr)
 		}
 	}
+
+	names, _ := readTestTar(t, filepath.Join(dir, "appjs.tar"), false)
+	if want := []string{"appjs/", "appjs/lib/", "appjs/lib/index.js"}; strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("Tarit() entries = %q, want %q", names, want)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "create")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "app")
+	os.MkdirAll(filepath.Join(src, "bin"), 0755)
+	ioutil.WriteFile(filepath.Join(src, "bin", "app"), []byte("#!/bin/sh"), 0755)
+	os.Symlink("bin/app", filepath.Join(src, "run"))
+	os.Link(filepath.Join(src, "bin", "app"), filepath.Join(src, "start"))
+
+	mtime := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	dst := filepath.Join(dir, "app.tar.gz")
+	if err := Create(dst, src, &Options{Prefix: "app", Uid: 1000, Gid: 1000, ModTime: mtime}); err != nil {
+		t.Fatal(err)
+	}
+
+	names, headers := readTestTar(t, dst, true)
+	want := []string{"app/", "app/bin/", "app/bin/app", "app/run", "app/start"}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("Create() entries = %q, want %q", names, want)
+	}
+	for _, hdr := range headers {
+		if hdr.Uid != 1000 || hdr.Gid != 1000 || !hdr.ModTime.Equal(mtime) {
+			t.Errorf("Create() %s owner = %d:%d, mtime = %v", hdr.Name, hdr.Uid, hdr.Gid, hdr.ModTime)
+		}
+	}
+	if hdr := headers[3]; hdr.Typeflag != tar.TypeSymlink || hdr.Linkname != "bin/app" {
+		t.Errorf("Create() run = %q -> %q, want a symlink", hdr.Typeflag, hdr.Linkname)
+	}
+	if hdr := headers[4]; hdr.Typeflag != tar.TypeLink || hdr.Linkname != "app/bin/app" {
+		t.Errorf("Create() start = %q -> %q, want a hardlink", hdr.Typeflag, hdr.Linkname)
+	}
+	if headers[2].Mode&0111 == 0 {
+		t.Errorf("Create() bin/app mode = %o", headers[2].Mode)
+	}
+}
+
+func readTestTar(t *testing.T, file string, gzipped bool) ([]string, []*tar.Header) {
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if gzipped {
+		if r, err = gzip.NewReader(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var names []string
+	var headers []*tar.Header
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+		headers = append(headers, hdr)
+	}
+	return names, headers
 }
@@ -0,0 +1,102 @@
+package tar
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/xshellinc/tools/lib/help"
+)
+
+// Overwrite is the policy for files existing in the destination
+type Overwrite = help.Overwrite
+
+// Overwrite policies of Untar
+const (
+	OverwriteAlways = help.OverwriteAlways
+	OverwriteNever  = help.OverwriteNever
+	OverwriteNewer  = help.OverwriteNewer
+	OverwriteError  = help.OverwriteError
+)
+
+// ErrSkipEntry is returned by the Callback of UntarOptions to skip the entry
+var ErrSkipEntry = help.ErrSkipEntry
+
+// UntarOptions configures Untar, nil options use the defaults
+type UntarOptions struct {
+	// StripComponents removes leading folders from the names, after ./ is removed.
+	// Entries with fewer folders are skipped
+	StripComponents int
+	// Include and Exclude select entries by their stripped names, see help.MatchArchiveName.
+	// All entries are included if Include is empty
+	Include []string
+	Exclude []string
+	// PreserveOwner sets the uid and gid of the entries, which usually needs root
+	PreserveOwner bool
+	Overwrite     Overwrite
+	// Sanitize extracts entries with ../ or absolute names under the destination and skips
+	// symlinks pointing outside of it, instead of failing
+	Sanitize bool
+	// Callback is called before an entry is written to the path, ErrSkipEntry skips it
+	// and other errors stop the extraction
+	Callback func(e *help.ArchiveEntry, path string) error
+}
+
+// extractOptions returns the options of help.Extract, which writes the entries
+func (o *UntarOptions) extractOptions() *help.ExtractOptions {
+	if o == nil {
+		return &help.ExtractOptions{}
+	}
+	return &help.ExtractOptions{
+		Sanitize:        o.Sanitize,
+		StripComponents: o.StripComponents,
+		Patterns:        o.Include,
+		Exclude:         o.Exclude,
+		PreserveOwner:   o.PreserveOwner,
+		Overwrite:       o.Overwrite,
+		Callback:        o.Callback,
+	}
+}
+
+// Untar extracts the tar archive into the dst folder. Entries are checked by the same
+// rules as help.Extract, so names and symlinks can't point outside of dst. Other formats
+// are rejected before anything is written
+func Untar(src, dst string, opts *UntarOptions) error {
+	return untarFile(src, dst, help.CompressionNone, opts)
+}
+
+// UntarGz extracts the gzipped tar archive into the dst folder, see Untar
+func UntarGz(src, dst string, opts *UntarOptions) error {
+	return untarFile(src, dst, help.CompressionGzip, opts)
+}
+
+func untarFile(src, dst string, compression help.Compression, opts *UntarOptions) error {
+	if err := checkCompression(src, compression); err != nil {
+		return err
+	}
+	_, err := help.ExtractTarFile(context.Background(), src, dst, opts.extractOptions())
+	return err
+}
+
+// checkCompression rejects archives which aren't compressed as expected
+func checkCompression(src string, compression help.Compression) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header := make([]byte, 6)
+	n, _ := io.ReadFull(f, header)
+	if found := help.DetectCompression(header[:n]); found != compression {
+		return fmt.Errorf("%s: %w: %s compression instead of %s", src, help.ErrUnknownArchive, found, compression)
+	}
+	return nil
+}
+
+// UntarReader extracts the tar stream into the dst folder, see Untar
+func UntarReader(r io.Reader, dst string, opts *UntarOptions) error {
+	_, err := help.ExtractTar(context.Background(), r, dst, opts.extractOptions())
+	return err
+}
@@ -0,0 +1,275 @@
+package tar
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xshellinc/tools/lib/help"
+)
+
+type testEntry struct {
+	name     string
+	body     string
+	typeflag byte
+	linkname string
+}
+
+func writeTestTarGz(t *testing.T, file string, entries []testEntry) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.body)), Typeflag: e.typeflag,
+			Linkname: e.linkname, ModTime: time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)}
+		switch e.typeflag {
+		case tar.TypeDir:
+			hdr.Mode = 0755
+		case tar.TypeSymlink, tar.TypeLink:
+			hdr.Size = 0
+		case 0:
+			hdr.Typeflag = tar.TypeReg
+		}
+		tw.WriteHeader(hdr)
+		tw.Write([]byte(e.body))
+	}
+	tw.Close()
+	gw.Close()
+	if err := ioutil.WriteFile(file, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// listTestDir returns the slash separated files and links under the dir
+func listTestDir(dir string) []string {
+	var files []string
+	filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err == nil && !fi.IsDir() {
+			rel, _ := filepath.Rel(dir, p)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files
+}
+
+func TestUntarGz(t *testing.T) {
+	dir, err := ioutil.TempDir("", "untar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "app.tar.gz")
+	writeTestTarGz(t, src, []testEntry{
+		{name: "./app/", typeflag: tar.TypeDir},
+		{name: "./app/bin/app", body: "#!/bin/sh"},
+		{name: "./app/config.json", body: "{}"},
+		{name: "./app/README.md", body: "readme"},
+		{name: "./app/run", typeflag: tar.TypeSymlink, linkname: "bin/app"},
+		{name: "./app/start", typeflag: tar.TypeLink, linkname: "./app/bin/app"},
+	})
+
+	var visited []string
+	tests := []struct {
+		name string
+		opts *UntarOptions
+		want []string
+	}{
+		{"defaults", nil, []string{"app/README.md", "app/bin/app", "app/config.json", "app/run", "app/start"}},
+		{"strip", &UntarOptions{StripComponents: 1}, []string{"README.md", "bin/app", "config.json", "run", "start"}},
+		{"include", &UntarOptions{StripComponents: 1, Include: []string{"bin/*", "*.json"}}, []string{"bin/app", "config.json"}},
+		{"exclude", &UntarOptions{StripComponents: 2, Exclude: []string{"*.md"}}, []string{"app"}},
+		{"callback", &UntarOptions{Callback: func(e *help.ArchiveEntry, path string) error {
+			visited = append(visited, e.Name)
+			if e.Type != help.EntryFile {
+				return ErrSkipEntry
+			}
+			return nil
+		}}, []string{"app/README.md", "app/bin/app", "app/config.json"}},
+	}
+	for _, tt := range tests {
+		dst := filepath.Join(dir, tt.name)
+		if err := UntarGz(src, dst, tt.opts); err != nil {
+			t.Errorf("%q. UntarGz() error = %v", tt.name, err)
+			continue
+		}
+		if got := listTestDir(dst); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%q. UntarGz() files = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if len(visited) != 6 {
+		t.Errorf("UntarGz() called back %d entries, want 6", len(visited))
+	}
+	strip := filepath.Join(dir, "strip")
+	if link, err := os.Readlink(filepath.Join(strip, "run")); err != nil || link != "bin/app" {
+		t.Errorf("UntarGz() symlink = %q, %v", link, err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(strip, "start")); string(data) != "#!/bin/sh" {
+		t.Errorf("UntarGz() hardlink reads %q", data)
+	}
+	if info, err := os.Stat(filepath.Join(strip, "config.json")); err != nil || info.ModTime().Year() != 2017 {
+		t.Errorf("UntarGz() didn't keep the modification time")
+	}
+}
+
+func TestUntarNotTar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "untar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a gzipped file which isn't a tar would be written as dst/config
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Write([]byte("not a tar"))
+	gw.Close()
+	src := filepath.Join(dir, "config.gz")
+	ioutil.WriteFile(src, buf.Bytes(), 0644)
+	dst := filepath.Join(dir, "dst")
+	os.Mkdir(dst, 0755)
+	ioutil.WriteFile(filepath.Join(dst, "config"), []byte("user data"), 0644)
+
+	if err := UntarGz(src, dst, nil); !errors.Is(err, help.ErrUnknownArchive) {
+		t.Errorf("UntarGz() error = %v, want ErrUnknownArchive", err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dst, "config")); string(data) != "user data" {
+		t.Errorf("UntarGz() overwrote the existing file with %q", data)
+	}
+}
+
+func TestListNotTar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "untar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("config.json")
+	w.Write([]byte("{}"))
+	zw.Close()
+	src := filepath.Join(dir, "image.zip")
+	ioutil.WriteFile(src, buf.Bytes(), 0644)
+
+	if _, err := List(src); !errors.Is(err, help.ErrUnknownArchive) {
+		t.Errorf("List() error = %v, want ErrUnknownArchive", err)
+	}
+	if _, err := ExtractMatching(src, []string{"*.json"}, filepath.Join(dir, "dst")); !errors.Is(err, help.ErrUnknownArchive) {
+		t.Errorf("ExtractMatching() error = %v, want ErrUnknownArchive", err)
+	}
+	if help.Exists(filepath.Join(dir, "dst")) {
+		t.Error("ExtractMatching() created the dst folder of a zip archive")
+	}
+	if _, err := ExtractMatchingTo(src, []string{"*.json"}, ioutil.Discard); !errors.Is(err, help.ErrUnknownArchive) {
+		t.Errorf("ExtractMatchingTo() error = %v, want ErrUnknownArchive", err)
+	}
+}
+
+func TestUntarOverwrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "untar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "config.tar.gz")
+	writeTestTarGz(t, src, []testEntry{{name: "config.json", body: "{}"}})
+	dst := filepath.Join(dir, "dst")
+	existing := filepath.Join(dst, "config.json")
+
+	tests := []struct {
+		policy  Overwrite
+		want    string
+		wantErr error
+	}{
+		{OverwriteNever, "local", nil},
+		// the local file is newer than the entry
+		{OverwriteNewer, "local", nil},
+		{OverwriteError, "local", os.ErrExist},
+		{OverwriteAlways, "{}", nil},
+	}
+	for _, tt := range tests {
+		os.MkdirAll(dst, 0755)
+		ioutil.WriteFile(existing, []byte("local"), 0644)
+
+		err := UntarGz(src, dst, &UntarOptions{Overwrite: tt.policy})
+		if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+			t.Errorf("%d. UntarGz() error = %v, want %v", tt.policy, err, tt.wantErr)
+		}
+		if data, _ := ioutil.ReadFile(existing); string(data) != tt.want {
+			t.Errorf("%d. UntarGz() file = %q, want %q", tt.policy, data, tt.want)
+		}
+	}
+}
+
+func TestUntarUnsafe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "untar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		entries []testEntry
+		strip   int
+		want    error
+	}{
+		{"traversal", []testEntry{{name: "../evil", body: "x"}}, 0, help.ErrPathTraversal},
+		// stripping doesn't remove ../
+		{"strip traversal", []testEntry{{name: "../../evil", body: "x"}}, 1, help.ErrPathTraversal},
+		{"absolute", []testEntry{{name: "/tmp/evil", body: "x"}}, 1, help.ErrPathTraversal},
+		{"symlink", []testEntry{
+			{name: "app/etc", typeflag: tar.TypeSymlink, linkname: "/etc"},
+			{name: "app/etc/passwd", body: "x"},
+		}, 1, help.ErrSymlinkEscape},
+	}
+	for _, tt := range tests {
+		src := filepath.Join(dir, strings.Replace(tt.name, " ", "-", -1)+".tar.gz")
+		writeTestTarGz(t, src, tt.entries)
+		if err := UntarGz(src, filepath.Join(dir, "dst"), &UntarOptions{StripComponents: tt.strip}); !errors.Is(err, tt.want) {
+			t.Errorf("%q. UntarGz() error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	if help.Exists(filepath.Join(dir, "evil")) {
+		t.Error("UntarGz() wrote outside of the destination")
+	}
+}
+
+func TestUntarSymlinkDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "untar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	victim := filepath.Join(dir, "victim")
+	os.Mkdir(victim, 0700)
+
+	// a/b/x resolves to the victim through s, and the folder entry would chmod it
+	src := filepath.Join(dir, "link.tar.gz")
+	writeTestTarGz(t, src, []testEntry{
+		{name: "a/b/s", typeflag: tar.TypeSymlink, linkname: "../.."},
+		{name: "a/b/x", typeflag: tar.TypeSymlink, linkname: "s/../../victim"},
+		{name: "a/b/x/", typeflag: tar.TypeDir},
+	})
+	if err := UntarGz(src, filepath.Join(dir, "d", "dst"), nil); !errors.Is(err, help.ErrSymlinkEscape) {
+		t.Errorf("UntarGz() error = %v, want ErrSymlinkEscape", err)
+	}
+	if info, err := os.Stat(victim); err != nil || info.Mode().Perm() != 0700 || info.ModTime().Year() == 2017 {
+		t.Errorf("UntarGz() changed the victim folder: %v, %v", info.Mode(), err)
+	}
+}
@@ -0,0 +1,196 @@
+package tar
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xshellinc/tools/lib/help"
+)
+
+// Options configures the Writer, nil options use the defaults
+type Options struct {
+	// Prefix is the folder of the entries in the archive, e.g. the name of the app
+	Prefix string
+	// PreserveOwner stores the uid and gid of the files, otherwise Uid and Gid are stored
+	PreserveOwner bool
+	Uid           int
+	Gid           int
+	// ModTime replaces the modification times of the files if it's set, e.g. for reproducible archives
+	ModTime time.Time
+}
+
+// Writer writes files, folders, symlinks and hardlinks into a tar archive with relative names
+type Writer struct {
+	tw    *tar.Writer
+	opts  Options
+	links map[fileID]string
+}
+
+// NewWriter returns the writer of a tar archive into w, Close doesn't close w
+func NewWriter(w io.Writer, opts *Options) *Writer {
+	return newWriter(tar.NewWriter(w), opts)
+}
+
+func newWriter(tw *tar.Writer, opts *Options) *Writer {
+	if opts == nil {
+		opts = &Options{}
+	}
+	return &Writer{tw: tw, opts: *opts, links: map[fileID]string{}}
+}
+
+// AddDir adds the folder and its contents recursively, the names are relative to the folder
+// under the Prefix. Symlinks are stored as links and aren't followed
+func (w *Writer) AddDir(dir string) error {
+	// the folder itself may be a symlink
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	return filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		name := path.Join(w.opts.Prefix, filepath.ToSlash(rel))
+		if name == "." {
+			// the root entry only exists with a prefix
+			return nil
+		}
+		return w.add(p, name, fi)
+	})
+}
+
+// AddFile adds a single file, folder or symlink as name under the Prefix
+func (w *Writer) AddFile(file, name string) error {
+	fi, err := os.Lstat(file)
+	if err != nil {
+		return err
+	}
+	return w.add(file, path.Join(w.opts.Prefix, filepath.ToSlash(name)), fi)
+}
+
+// Close writes the end of the archive
+func (w *Writer) Close() error {
+	return w.tw.Close()
+}
+
+func (w *Writer) add(file, name string, fi os.FileInfo) error {
+	if fi.Mode()&os.ModeSocket != 0 {
+		log.Debug("Skipping socket ", file)
+		return nil
+	}
+
+	var link string
+	if fi.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(file); err != nil {
+			return err
+		}
+	}
+	hdr, err := tar.FileInfoHeader(fi, filepath.ToSlash(link))
+	if err != nil {
+		return err
+	}
+
+	hdr.Name = strings.TrimPrefix(name, "/")
+	if fi.IsDir() {
+		hdr.Name += "/"
+	}
+	if !w.opts.PreserveOwner {
+		hdr.Uid, hdr.Gid = w.opts.Uid, w.opts.Gid
+		hdr.Uname, hdr.Gname = "", ""
+	}
+	if !w.opts.ModTime.IsZero() {
+		hdr.ModTime = w.opts.ModTime
+	}
+	// access and change times need the PAX format which old tar tools don't read
+	hdr.AccessTime, hdr.ChangeTime = time.Time{}, time.Time{}
+
+	if fi.Mode().IsRegular() {
+		if id, ok := getFileID(fi); ok {
+			if target, ok := w.links[id]; ok {
+				hdr.Typeflag = tar.TypeLink
+				hdr.Linkname = target
+				hdr.Size = 0
+				return w.tw.WriteHeader(hdr)
+			}
+			w.links[id] = hdr.Name
+		}
+	}
+
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.CopyN(w.tw, f, hdr.Size)
+	return err
+}
+
+// Create writes the src folder or file into the dst archive, which is gzipped if it ends with
+// .gz or .tgz. A folder's contents are stored under the Prefix, a file as Prefix/name.
+// The archive is removed if it fails
+func Create(dst, src string, opts *Options) error {
+	return create(dst, src, help.HasAnySuffixes(strings.ToLower(dst), ".gz", ".tgz"), opts)
+}
+
+func create(dst, src string, gzipped bool, opts *Options) (err error) {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(dst)
+		}
+	}()
+
+	var out io.Writer = f
+	var gw *gzip.Writer
+	if gzipped {
+		gw = gzip.NewWriter(f)
+		out = gw
+	}
+
+	w := NewWriter(out, opts)
+	if fi.IsDir() {
+		err = w.AddDir(src)
+	} else {
+		err = w.AddFile(src, filepath.Base(src))
+	}
+	if err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if gw != nil {
+		return gw.Close()
+	}
+	return nil
+}